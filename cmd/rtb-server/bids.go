@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rtb/internal/auction"
+	"rtb/internal/cluster"
+	"rtb/internal/users"
+
+	"github.com/gorilla/mux"
+)
+
+// bidTimeout bounds how long POST /api/auctions/{id}/bids waits for the
+// room to decide.
+const bidTimeout = 5 * time.Second
+
+// BidPage is one page of an auction's bid history. NextCursor, when set, is
+// passed back as ?cursor= for the following page.
+type BidPage struct {
+	Bids       []auction.BidView `json:"bids"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// bidQuery reads ?cursor=, ?user=, ?status=accepted|rejected and ?limit=
+// (default 50, at most 500).
+func bidQuery(r *http.Request) (auction.BidQuery, error) {
+	v := r.URL.Query()
+	q := auction.BidQuery{UserID: v.Get("user"), Limit: 50}
+	if c := v.Get("cursor"); c != "" {
+		seq, err := strconv.ParseInt(c, 10, 64)
+		if err != nil || seq < 0 {
+			return q, errors.New("invalid cursor")
+		}
+		q.AfterSeq = seq
+	}
+	switch v.Get("status") {
+	case "":
+	case "accepted", "rejected":
+		accepted := v.Get("status") == "accepted"
+		q.Accepted = &accepted
+	default:
+		return q, errors.New("status must be accepted or rejected")
+	}
+	if l := v.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = min(n, 500)
+	}
+	return q, nil
+}
+
+func registerBidRoutes(r *mux.Router, mgr *auction.Manager, accounts *users.Service, cl *cluster.Cluster) {
+	r.HandleFunc("/api/auctions/{id}/bids", func(w http.ResponseWriter, r *http.Request) {
+		q, err := bidQuery(r)
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bids, err := mgr.Bids(mux.Vars(r)["id"], q)
+		switch {
+		case errors.Is(err, auction.ErrNotFound):
+			writeErr(w, http.StatusNotFound, "not found")
+		case errors.Is(err, auction.ErrBidsSealed):
+			writeErr(w, http.StatusForbidden, "bids sealed until close")
+		case err != nil:
+			writeErr(w, http.StatusInternalServerError, "lookup failed")
+		default:
+			page := BidPage{Bids: bids}
+			if page.Bids == nil {
+				page.Bids = []auction.BidView{}
+			}
+			if len(bids) == q.Limit {
+				page.NextCursor = strconv.FormatInt(bids[len(bids)-1].Seq, 10)
+			}
+			writeJSON(w, http.StatusOK, page)
+		}
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	r.Handle("/api/auctions/{id}/bids", onOwner(cl, auctionRoom, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := accounts.Authenticate(r)
+		if err != nil {
+			writeErr(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		var req AmountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		key := r.Header.Get("Idempotency-Key")
+		if len(key) > 255 {
+			writeErr(w, http.StatusBadRequest, "idempotency key too long")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), bidTimeout)
+		defer cancel()
+		res, err := mgr.PlaceBid(ctx, mux.Vars(r)["id"], u.Participant(), auction.ToCents(req.Amount), key)
+		switch {
+		case errors.Is(err, auction.ErrNotFound):
+			writeErr(w, http.StatusNotFound, "not found")
+		case errors.Is(err, context.DeadlineExceeded):
+			// The room may still apply it; retrying with the same key is safe.
+			writeErr(w, http.StatusGatewayTimeout, "bid not decided in time")
+		case err != nil:
+			writeErr(w, http.StatusInternalServerError, "bid failed")
+		case res.Accepted:
+			writeJSON(w, http.StatusCreated, res)
+		default:
+			writeJSON(w, http.StatusUnprocessableEntity, res)
+		}
+	}))).Methods(http.MethodPost)
+}
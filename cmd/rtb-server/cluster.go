@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"rtb/internal/cluster"
+
+	"github.com/gorilla/mux"
+)
+
+// clusterNode joins a cluster when RTB_CLUSTER_URL, this node's base URL as
+// the other nodes reach it, is set. RTB_CLUSTER_SEEDS lists other nodes'
+// URLs, comma-separated, to join through; RTB_CLUSTER_SECRET is shared by
+// every node; nodes are probed every RTB_CLUSTER_PROBE_INTERVAL (2s).
+func clusterNode() (*cluster.Cluster, error) {
+	self := os.Getenv("RTB_CLUSTER_URL")
+	if self == "" {
+		return nil, nil
+	}
+	if getEnv("RTB_STORE", "memory") == "memory" {
+		return nil, errors.New("cluster mode needs stores shared by every node; set RTB_STORE")
+	}
+	if os.Getenv("RTB_AUTH_SECRET") == "" {
+		return nil, errors.New("cluster mode needs the same RTB_AUTH_SECRET on every node, or tokens only work on the node that issued them")
+	}
+	if os.Getenv("RTB_DATA_DIR") != "" {
+		return nil, errors.New("RTB_DATA_DIR is per node and cannot be used in cluster mode")
+	}
+	interval, err := time.ParseDuration(getEnv("RTB_CLUSTER_PROBE_INTERVAL", "2s"))
+	if err != nil {
+		return nil, fmt.Errorf("RTB_CLUSTER_PROBE_INTERVAL: %w", err)
+	}
+	var seeds []string
+	for _, s := range strings.Split(os.Getenv("RTB_CLUSTER_SEEDS"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			seeds = append(seeds, s)
+		}
+	}
+	return cluster.New(cluster.Config{
+		URL:           self,
+		Seeds:         seeds,
+		Secret:        os.Getenv("RTB_CLUSTER_SECRET"),
+		ProbeInterval: interval,
+	})
+}
+
+// onOwner routes requests for a room to the node that runs it. Outside
+// cluster mode every room is local.
+func onOwner(cl *cluster.Cluster, room func(*http.Request) string, h http.Handler) http.Handler {
+	if cl == nil {
+		return h
+	}
+	return cl.Forward(room, h)
+}
+
+// auctionRoom is the room of /api/auctions/{id}/... routes.
+func auctionRoom(r *http.Request) string {
+	return mux.Vars(r)["id"]
+}
+
+// roomHint is the ?room= a realtime connection may name on connecting. The
+// connection may still follow other rooms; joining one run elsewhere is
+// refused with wrong_node.
+func roomHint(r *http.Request) string {
+	return r.URL.Query().Get("room")
+}
@@ -2,39 +2,102 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"rtb/internal/auction"
+	"rtb/internal/auth"
+	"rtb/internal/cluster"
+	"rtb/internal/openrtb"
 	"rtb/internal/realtime"
+	"rtb/internal/sqlitestore"
+	"rtb/internal/turnrelay"
+	"rtb/internal/users"
+	"rtb/internal/wallet"
 
 	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
 )
 
 // Basic types for the HTTP API (auctions CRUD) kept in this file for simplicity of scaffold.
 type CreateAuctionRequest struct {
-	Title            string  `json:"title"`
-	StartPrice       float64 `json:"startPrice"`
-	MinIncrement     float64 `json:"minIncrement"`
-	DurationSeconds  int64   `json:"durationSeconds"`
-	SoftCloseSeconds int64   `json:"softCloseSeconds"`
-	ReservePrice     float64 `json:"reservePrice"`
-}
-
-func toCents(v float64) int64 {
-	return int64(v*100 + 0.5)
-}
-
-func fromCents(v int64) float64 {
-	return float64(v) / 100
+	Title             string  `json:"title"`
+	Format            string  `json:"format"`
+	StartPrice        float64 `json:"startPrice"`
+	MinIncrement      float64 `json:"minIncrement"`
+	StartDelaySeconds int64   `json:"startDelaySeconds"`
+	DurationSeconds   int64   `json:"durationSeconds"`
+	SoftCloseSeconds  int64   `json:"softCloseSeconds"`
+	ReservePrice      float64 `json:"reservePrice"`
+	// Dutch auctions only.
+	Decrement                float64 `json:"decrement"`
+	DecrementIntervalSeconds int64   `json:"decrementIntervalSeconds"`
+	FloorPrice               float64 `json:"floorPrice"`
 }
 
 func main() {
 	addr := listenAddr()
-	mgr := auction.NewManager()
+	issuer, err := authIssuer()
+	if err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	st, err := openStores()
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	defer st.close()
+	mgr := auction.NewManager(st.auctions, st.bids)
+	accounts := users.NewService(st.users, issuer)
+	ledger, err := walletLedger(st.wallets)
+	if err != nil {
+		log.Fatalf("wallet: %v", err)
+	}
+	mgr.UseFunds(ledger)
+	historyLimit, err := strconv.Atoi(getEnv("RTB_ROOM_HISTORY", strconv.Itoa(auction.DefaultHistoryLimit)))
+	if err != nil || historyLimit <= 0 {
+		log.Fatalf("RTB_ROOM_HISTORY: invalid count %q", os.Getenv("RTB_ROOM_HISTORY"))
+	}
+	mgr.SetHistoryLimit(historyLimit)
+	cl, err := clusterNode()
+	if err != nil {
+		log.Fatalf("cluster: %v", err)
+	}
+	if cl != nil {
+		mgr.UsePlacement(cl)
+		cl.Probe()
+	}
+	if dir := os.Getenv("RTB_DATA_DIR"); dir != "" {
+		j, err := auction.OpenJournal(dir)
+		if err != nil {
+			log.Fatalf("journal: %v", err)
+		}
+		defer j.Close()
+		if err := mgr.Recover(j); err != nil {
+			log.Fatalf("recover: %v", err)
+		}
+		interval, err := time.ParseDuration(getEnv("RTB_SNAPSHOT_INTERVAL", "5m"))
+		if err != nil {
+			log.Fatalf("RTB_SNAPSHOT_INTERVAL: %v", err)
+		}
+		go j.SnapshotEvery(interval, nil)
+	}
+	if err := mgr.ResumeRooms(); err != nil {
+		log.Fatalf("resume rooms: %v", err)
+	}
+	if cl != nil {
+		go cl.Run(func() {
+			if err := mgr.Rebalance(); err != nil {
+				log.Printf("rebalance: %v", err)
+			}
+		})
+	}
 
 	r := mux.NewRouter()
 	r.Use(simpleCORS)
@@ -45,11 +108,19 @@ func main() {
 		_, _ = w.Write([]byte("ok"))
 	}).Methods(http.MethodGet, http.MethodOptions)
 
+	registerUserRoutes(r, accounts)
+	registerWalletRoutes(r, accounts, ledger)
+
 	// Auctions API
 	r.HandleFunc("/api/auctions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			writeJSON(w, http.StatusOK, mgr.List())
+			list, err := mgr.List()
+			if err != nil {
+				writeErr(w, http.StatusInternalServerError, "list failed")
+				return
+			}
+			writeJSON(w, http.StatusOK, list)
 			return
 		case http.MethodPost:
 			var req CreateAuctionRequest
@@ -61,20 +132,53 @@ func main() {
 				writeErr(w, http.StatusBadRequest, "title required")
 				return
 			}
+			format := auction.Format(req.Format)
+			if format == "" {
+				format = auction.FormatEnglish
+			}
+			if !format.Valid() {
+				writeErr(w, http.StatusBadRequest, "unknown format")
+				return
+			}
+			if format == auction.FormatDutch {
+				if req.Decrement <= 0 {
+					writeErr(w, http.StatusBadRequest, "decrement required for dutch auctions")
+					return
+				}
+				if req.FloorPrice > req.StartPrice {
+					writeErr(w, http.StatusBadRequest, "floor price above start price")
+					return
+				}
+				if req.FloorPrice < req.ReservePrice {
+					// The price would drop to where the first bid wins but
+					// cannot meet the reserve.
+					writeErr(w, http.StatusBadRequest, "floor price below reserve price")
+					return
+				}
+			}
 			if req.DurationSeconds <= 0 {
 				req.DurationSeconds = 60
 			}
 			if req.MinIncrement <= 0 {
 				req.MinIncrement = 1
 			}
-			a := mgr.Create(auction.CreateAuctionParams{
-				Title:             req.Title,
-				StartPriceCents:   toCents(req.StartPrice),
-				MinIncrementCents: toCents(req.MinIncrement),
-				DurationSeconds:   req.DurationSeconds,
-				SoftCloseSeconds:  req.SoftCloseSeconds,
-				ReservePriceCents: toCents(req.ReservePrice),
+			a, err := mgr.Create(auction.CreateAuctionParams{
+				Title:                    req.Title,
+				Format:                   format,
+				StartPriceCents:          auction.ToCents(req.StartPrice),
+				MinIncrementCents:        auction.ToCents(req.MinIncrement),
+				StartDelaySeconds:        req.StartDelaySeconds,
+				DurationSeconds:          req.DurationSeconds,
+				SoftCloseSeconds:         req.SoftCloseSeconds,
+				ReservePriceCents:        auction.ToCents(req.ReservePrice),
+				DecrementCents:           auction.ToCents(req.Decrement),
+				DecrementIntervalSeconds: req.DecrementIntervalSeconds,
+				FloorPriceCents:          auction.ToCents(req.FloorPrice),
 			})
+			if err != nil {
+				writeErr(w, http.StatusInternalServerError, "create failed")
+				return
+			}
 			writeJSON(w, http.StatusCreated, a)
 			return
 		default:
@@ -85,18 +189,122 @@ func main() {
 
 	r.HandleFunc("/api/auctions/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
-		a, ok := mgr.Get(id)
-		if !ok {
+		a, err := mgr.Get(id)
+		switch {
+		case errors.Is(err, auction.ErrNotFound):
 			writeErr(w, http.StatusNotFound, "not found")
+		case err != nil:
+			writeErr(w, http.StatusInternalServerError, "lookup failed")
+		default:
+			writeJSON(w, http.StatusOK, a)
+		}
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	// Cancelling releases every bidder's hold, so only operators may do it.
+	r.Handle("/api/auctions/{id}/cancel", onOwner(cl, auctionRoom, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			writeErr(w, http.StatusForbidden, "forbidden")
 			return
 		}
-		writeJSON(w, http.StatusOK, a)
+		id := mux.Vars(r)["id"]
+		switch err := mgr.Cancel(id); {
+		case errors.Is(err, auction.ErrNotFound):
+			writeErr(w, http.StatusNotFound, "not found")
+		case errors.Is(err, auction.ErrAuctionFinal):
+			writeErr(w, http.StatusConflict, "auction already finished")
+		case err != nil:
+			writeErr(w, http.StatusInternalServerError, "cancel failed")
+		default:
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/api/auctions/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		s, err := mgr.Result(id)
+		switch {
+		case errors.Is(err, auction.ErrNotFound):
+			writeErr(w, http.StatusNotFound, "not found")
+		case errors.Is(err, auction.ErrNotSettled):
+			writeErr(w, http.StatusConflict, "auction not settled")
+		case err != nil:
+			writeErr(w, http.StatusInternalServerError, "lookup failed")
+		default:
+			writeJSON(w, http.StatusOK, s)
+		}
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	registerBidRoutes(r, mgr, accounts, cl)
+
+	// Read-only event stream for spectators
+	sse := &realtime.SSEHandler{Mgr: mgr}
+	r.Handle("/api/auctions/{id}/events", onOwner(cl, auctionRoom, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sse.ServeRoom(w, r, mux.Vars(r)["id"])
+	}))).Methods(http.MethodGet, http.MethodOptions)
+
+	// OpenRTB exchange
+	bidders, err := openRTBRegistry()
+	if err != nil {
+		log.Fatalf("bidders: %v", err)
+	}
+	r.Handle("/openrtb2/auction", &openrtb.Handler{Exchange: openrtb.NewExchange(bidders)}).Methods(http.MethodPost)
+	r.HandleFunc("/openrtb2/bidders", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, bidders.Stats())
 	}).Methods(http.MethodGet, http.MethodOptions)
 
 	// Realtime WebSocket
-	r.Handle("/ws", &realtime.WSHandler{Mgr: mgr})
+	r.Handle("/ws", onOwner(cl, roomHint, &realtime.WSHandler{Mgr: mgr, Users: accounts}))
 	// WebRTC signaling over WebSocket
-	r.Handle("/signal", &realtime.SignalWS{Mgr: mgr})
+	ice, err := iceServers()
+	if err != nil {
+		log.Fatalf("ice servers: %v", err)
+	}
+	peers, err := peerRegistry()
+	if err != nil {
+		log.Fatalf("webrtc limits: %v", err)
+	}
+	r.Handle("/signal", onOwner(cl, roomHint, &realtime.SignalWS{Mgr: mgr, Users: accounts, Peers: peers, ICEServers: ice}))
+	r.HandleFunc("/api/admin/webrtc/sessions", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			writeErr(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		writeJSON(w, http.StatusOK, peers.Stats())
+	}).Methods(http.MethodGet, http.MethodOptions)
+	relay, err := turnRelay(issuer)
+	if err != nil {
+		log.Fatalf("turn: %v", err)
+	}
+	if relay != nil {
+		defer relay.Close()
+	}
+	// Clients configure their peer connections with the same servers. TURN
+	// credentials are only handed to signed-in users; the embedded relay's
+	// expire with the caller's session token.
+	r.HandleFunc("/api/ice-servers", func(w http.ResponseWriter, r *http.Request) {
+		claims, err := issuer.Authenticate(r)
+		if err != nil {
+			writeErr(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		servers := ice
+		if relay != nil {
+			servers = append(slices.Clip(ice), relay.Credentials(claims.Subject, time.Unix(claims.ExpiresAt, 0)))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"iceServers": servers})
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	// Cluster membership
+	if cl != nil {
+		r.HandleFunc(cluster.PingPath, cl.ServePing).Methods(http.MethodPost)
+		r.HandleFunc("/api/admin/cluster", func(w http.ResponseWriter, r *http.Request) {
+			if !isAdmin(r) {
+				writeErr(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"members": cl.Members()})
+		}).Methods(http.MethodGet, http.MethodOptions)
+	}
 
 	server := &http.Server{
 		Addr:              addr,
@@ -128,6 +336,140 @@ func listenAddr() string {
 	return addr
 }
 
+type stores struct {
+	auctions auction.AuctionStore
+	bids     auction.BidStore
+	users    users.Store
+	wallets  wallet.Store
+	close    func()
+}
+
+// openStores picks the storage backend from RTB_STORE: "memory" (default)
+// or "sqlite", which keeps its database at RTB_SQLITE_PATH.
+func openStores() (*stores, error) {
+	switch kind := getEnv("RTB_STORE", "memory"); kind {
+	case "memory":
+		s := auction.NewMemoryStore()
+		return &stores{auctions: s, bids: s, users: users.NewMemoryStore(), wallets: wallet.NewMemoryStore(), close: func() {}}, nil
+	case "sqlite":
+		s, err := sqlitestore.Open(getEnv("RTB_SQLITE_PATH", "rtb.db"))
+		if err != nil {
+			return nil, err
+		}
+		return &stores{auctions: s, bids: s, users: s, wallets: s, close: func() { _ = s.Close() }}, nil
+	default:
+		return nil, fmt.Errorf("unknown RTB_STORE %q", kind)
+	}
+}
+
+// authIssuer signs session tokens with RTB_AUTH_SECRET. Without one a random
+// secret is used, so tokens do not survive a restart.
+func authIssuer() (*auth.Issuer, error) {
+	ttl, err := time.ParseDuration(getEnv("RTB_TOKEN_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("RTB_TOKEN_TTL: %w", err)
+	}
+	secret := []byte(os.Getenv("RTB_AUTH_SECRET"))
+	if len(secret) == 0 {
+		log.Printf("RTB_AUTH_SECRET not set; using a random secret, tokens will not survive a restart")
+		secret = auth.RandomSecret()
+	}
+	return auth.NewIssuer(secret, ttl), nil
+}
+
+// walletLedger opens wallets on first use with RTB_DEFAULT_CREDIT_LIMIT
+// dollars of credit (default 1000), so new bidders can take part before an
+// operator funds them.
+func walletLedger(store wallet.Store) (*wallet.Ledger, error) {
+	limit, err := strconv.ParseFloat(getEnv("RTB_DEFAULT_CREDIT_LIMIT", "1000"), 64)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("RTB_DEFAULT_CREDIT_LIMIT: invalid amount %q", os.Getenv("RTB_DEFAULT_CREDIT_LIMIT"))
+	}
+	return wallet.NewLedger(store, auction.ToCents(limit)), nil
+}
+
+// openRTBRegistry loads bidder adapters from RTB_BIDDERS_FILE. Without a
+// file the exchange runs with no bidders and every request is a no-bid.
+func openRTBRegistry() (*openrtb.Registry, error) {
+	path := os.Getenv("RTB_BIDDERS_FILE")
+	if path == "" {
+		return openrtb.NewRegistry(), nil
+	}
+	return openrtb.LoadRegistry(path)
+}
+
+// iceServers reads the STUN/TURN servers from RTB_ICE_SERVERS, a JSON list
+// in RTCIceServer form, e.g.
+// [{"urls":["turn:turn.example.com:3478"],"username":"u","credential":"p"}].
+// Without it Google's public STUN server is used; "[]" disables STUN for
+// networks without outside access.
+func iceServers() ([]webrtc.ICEServer, error) {
+	raw := getEnv("RTB_ICE_SERVERS", `[{"urls":["stun:stun.l.google.com:19302"]}]`)
+	var servers []webrtc.ICEServer
+	if err := json.Unmarshal([]byte(raw), &servers); err != nil {
+		return nil, fmt.Errorf("RTB_ICE_SERVERS: %w", err)
+	}
+	for _, s := range servers {
+		if len(s.URLs) == 0 {
+			return nil, errors.New("RTB_ICE_SERVERS: server without urls")
+		}
+	}
+	if servers == nil {
+		servers = []webrtc.ICEServer{}
+	}
+	return servers, nil
+}
+
+// turnRelay starts the embedded TURN server when RTB_TURN_ADDR (e.g.
+// ":3478") is set. RTB_TURN_PUBLIC_IP is the address clients reach it on and
+// RTB_TURN_REALM defaults to "rtb". Credentials are derived from the token
+// secret, so they verify for as long as the session token would.
+func turnRelay(issuer *auth.Issuer) (*turnrelay.Relay, error) {
+	addr := os.Getenv("RTB_TURN_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	relay, err := turnrelay.Start(turnrelay.Config{
+		ListenAddr: addr,
+		PublicIP:   os.Getenv("RTB_TURN_PUBLIC_IP"),
+		Realm:      getEnv("RTB_TURN_REALM", "rtb"),
+		Secret:     issuer.Secret(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("turn relay listening on %s (udp, tcp)", addr)
+	return relay, nil
+}
+
+// peerRegistry limits WebRTC sessions with RTB_WEBRTC_MAX_SESSIONS (default
+// 1000), RTB_WEBRTC_MAX_PER_USER (4) and RTB_WEBRTC_MAX_PER_IP (16), 0 for
+// no limit, and closes peers whose DataChannel is not open after
+// RTB_WEBRTC_OPEN_TIMEOUT (20s).
+func peerRegistry() (*realtime.PeerRegistry, error) {
+	var limits realtime.PeerLimits
+	for _, l := range []struct {
+		key, def string
+		dst      *int
+	}{
+		{"RTB_WEBRTC_MAX_SESSIONS", "1000", &limits.Total},
+		{"RTB_WEBRTC_MAX_PER_USER", "4", &limits.PerUser},
+		{"RTB_WEBRTC_MAX_PER_IP", "16", &limits.PerIP},
+	} {
+		n, err := strconv.Atoi(getEnv(l.key, l.def))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s: invalid count %q", l.key, os.Getenv(l.key))
+		}
+		*l.dst = n
+	}
+	timeout, err := time.ParseDuration(getEnv("RTB_WEBRTC_OPEN_TIMEOUT", "20s"))
+	if err != nil {
+		return nil, fmt.Errorf("RTB_WEBRTC_OPEN_TIMEOUT: %w", err)
+	}
+	limits.OpenTimeout = timeout
+	return realtime.NewPeerRegistry(limits), nil
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -155,8 +497,8 @@ func simpleCORS(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Vary", "Origin")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
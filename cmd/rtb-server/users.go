@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"rtb/internal/users"
+
+	"github.com/gorilla/mux"
+)
+
+type RegisterRequest struct {
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Password    string `json:"password"`
+}
+
+type LoginRequest struct {
+	Handle   string `json:"handle"`
+	Password string `json:"password"`
+}
+
+type UpdateProfileRequest struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"displayName"`
+}
+
+// PublicUser is what other bidders may see of an account.
+type PublicUser struct {
+	ID          string `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName"`
+	Verified    bool   `json:"verified"`
+}
+
+func registerUserRoutes(r *mux.Router, accounts *users.Service) {
+	r.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
+		var req RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		u, err := accounts.Register(users.RegisterParams{Handle: req.Handle, DisplayName: req.DisplayName, Password: req.Password})
+		if err != nil {
+			writeUserErr(w, err)
+			return
+		}
+		writeSession(w, http.StatusCreated, accounts, u)
+	}).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/api/users/login", func(w http.ResponseWriter, r *http.Request) {
+		var req LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErr(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		u, err := accounts.Login(req.Handle, req.Password)
+		if err != nil {
+			writeUserErr(w, err)
+			return
+		}
+		writeSession(w, http.StatusOK, accounts, u)
+	}).Methods(http.MethodPost, http.MethodOptions)
+
+	r.HandleFunc("/api/users/me", func(w http.ResponseWriter, r *http.Request) {
+		u, err := accounts.Authenticate(r)
+		if err != nil {
+			writeErr(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if r.Method == http.MethodPatch {
+			var req UpdateProfileRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErr(w, http.StatusBadRequest, "invalid json")
+				return
+			}
+			if u, err = accounts.UpdateProfile(u.ID, users.ProfileUpdate{Handle: req.Handle, DisplayName: req.DisplayName}); err != nil {
+				writeUserErr(w, err)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, u)
+	}).Methods(http.MethodGet, http.MethodPatch, http.MethodOptions)
+
+	r.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		u, err := accounts.Get(mux.Vars(r)["id"])
+		if err != nil {
+			writeUserErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, publicUser(u))
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	// Operators mark accounts verified with RTB_ADMIN_TOKEN.
+	r.HandleFunc("/api/users/{id}/verify", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			writeErr(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		var req struct {
+			Verified *bool `json:"verified"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		verified := req.Verified == nil || *req.Verified
+		u, err := accounts.SetVerified(mux.Vars(r)["id"], verified)
+		if err != nil {
+			writeUserErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, u)
+	}).Methods(http.MethodPost, http.MethodOptions)
+}
+
+func publicUser(u *users.User) PublicUser {
+	return PublicUser{ID: u.ID, Handle: u.Handle, DisplayName: u.DisplayName, Verified: u.Verified}
+}
+
+func writeSession(w http.ResponseWriter, status int, accounts *users.Service, u *users.User) {
+	s, err := accounts.Session(u)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, "session failed")
+		return
+	}
+	writeJSON(w, status, s)
+}
+
+func writeUserErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, users.ErrNotFound):
+		writeErr(w, http.StatusNotFound, "not found")
+	case errors.Is(err, users.ErrHandleTaken):
+		writeErr(w, http.StatusConflict, err.Error())
+	case errors.Is(err, users.ErrInvalidHandle), errors.Is(err, users.ErrWeakPassword),
+		errors.Is(err, users.ErrLongPassword):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, users.ErrInvalidCredentials):
+		writeErr(w, http.StatusUnauthorized, err.Error())
+	default:
+		writeErr(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// isAdmin checks the bearer token against RTB_ADMIN_TOKEN. Admin endpoints
+// are disabled when it is unset.
+func isAdmin(r *http.Request) bool {
+	want := os.Getenv("RTB_ADMIN_TOKEN")
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return want != "" && ok && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"rtb/internal/auction"
+	"rtb/internal/users"
+	"rtb/internal/wallet"
+
+	"github.com/gorilla/mux"
+)
+
+type WalletView struct {
+	*wallet.Account
+	HeldCents      int64 `json:"heldCents"`
+	AvailableCents int64 `json:"availableCents"`
+}
+
+// AmountRequest carries a dollar amount, like the auction API.
+type AmountRequest struct {
+	Amount float64 `json:"amount"`
+}
+
+func walletView(a *wallet.Account) WalletView {
+	return WalletView{Account: a, HeldCents: a.HeldCents(), AvailableCents: a.AvailableCents()}
+}
+
+func registerWalletRoutes(r *mux.Router, accounts *users.Service, ledger *wallet.Ledger) {
+	r.HandleFunc("/api/wallet", func(w http.ResponseWriter, r *http.Request) {
+		u, err := accounts.Authenticate(r)
+		if err != nil {
+			writeErr(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		a, err := ledger.Account(u.ID)
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, "lookup failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, walletView(a))
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	r.HandleFunc("/api/wallet/entries", func(w http.ResponseWriter, r *http.Request) {
+		u, err := accounts.Authenticate(r)
+		if err != nil {
+			writeErr(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		entries, err := ledger.Entries(u.ID)
+		if err != nil {
+			writeErr(w, http.StatusInternalServerError, "lookup failed")
+			return
+		}
+		if entries == nil {
+			entries = []wallet.Entry{}
+		}
+		writeJSON(w, http.StatusOK, entries)
+	}).Methods(http.MethodGet, http.MethodOptions)
+
+	// Operators fund wallets and set credit limits with RTB_ADMIN_TOKEN.
+	adminWallet := func(apply func(userID string, cents int64) (*wallet.Account, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !isAdmin(r) {
+				writeErr(w, http.StatusForbidden, "forbidden")
+				return
+			}
+			var req AmountRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeErr(w, http.StatusBadRequest, "invalid json")
+				return
+			}
+			if req.Amount < 0 {
+				writeErr(w, http.StatusBadRequest, "amount must not be negative")
+				return
+			}
+			u, err := accounts.Get(mux.Vars(r)["id"])
+			if err != nil {
+				writeUserErr(w, err)
+				return
+			}
+			a, err := apply(u.ID, auction.ToCents(req.Amount))
+			if err != nil {
+				writeErr(w, http.StatusInternalServerError, "update failed")
+				return
+			}
+			writeJSON(w, http.StatusOK, walletView(a))
+		}
+	}
+	r.HandleFunc("/api/users/{id}/wallet/deposit", adminWallet(ledger.Deposit)).Methods(http.MethodPost, http.MethodOptions)
+	r.HandleFunc("/api/users/{id}/wallet/credit-limit", adminWallet(ledger.SetCreditLimit)).Methods(http.MethodPost, http.MethodOptions)
+}
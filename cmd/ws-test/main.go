@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
@@ -55,8 +56,13 @@ func main() {
 	mustJSON(httpPostJSON(api+"/api/auctions", createBody, &created))
 	log.Printf("Created auction: id=%s endsAt=%s", created.ID, created.EndsAt.Format(time.RFC3339))
 
-	// 2) Connect WS
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	// 2) Register and connect WS with the session token
+	var session struct {
+		Token string `json:"token"`
+	}
+	account := map[string]string{"handle": fmt.Sprintf("cli-%d", time.Now().UnixNano()), "password": "ws-test-password"}
+	mustJSON(httpPostJSON(api+"/api/users", account, &session))
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+url.QueryEscape(session.Token), nil)
 	if err != nil {
 		log.Fatalf("ws dial: %v", err)
 	}
@@ -66,7 +72,6 @@ func main() {
 	join := map[string]any{
 		"type":   "join_room",
 		"roomId": created.ID,
-		"user":   map[string]string{"id": "cli-1", "handle": "cli"},
 	}
 	must(conn.WriteJSON(join))
 	log.Printf("Joined room %s", created.ID)
@@ -81,13 +86,13 @@ func main() {
 	bid := map[string]any{
 		"type":        "place_bid",
 		"roomId":      created.ID,
-		"user":        map[string]string{"id": "cli-1", "handle": "cli"},
 		"amountCents": next,
 	}
 	must(conn.WriteJSON(bid))
 	log.Printf("Placed bid: %0.2f", float64(next)/100)
 
-	// 6) Wait for new state and verify
+	// 6) Ask for a fresh snapshot (the room only broadcasts patches) and verify
+	must(conn.WriteJSON(map[string]any{"type": "snapshot", "roomId": created.ID}))
 	after := waitForState(conn, 5*time.Second)
 	log.Printf("After bid: price=%0.2f leader=%s endsAt=%s",
 		float64(after.CurrentPriceCts)/100, after.LeaderHandle, after.EndsAt.Format(time.RFC3339))
@@ -0,0 +1,92 @@
+package auction
+
+import "time"
+
+// dropPrice lowers the price of an open Dutch auction by one decrement per
+// elapsed interval, never below the floor.
+func (r *Room) dropPrice(now time.Time) {
+	if r.auction.Status != StatusOpen || r.auction.DecrementCents <= 0 {
+		return
+	}
+	interval := time.Duration(r.auction.DecrementIntervalSeconds) * time.Second
+	dropped := false
+	for !now.Before(r.nextDropAt) && r.currentPriceCts > r.auction.FloorPriceCents {
+		r.currentPriceCts = max(r.currentPriceCts-r.auction.DecrementCents, r.auction.FloorPriceCents)
+		r.nextDropAt = r.nextDropAt.Add(interval)
+		dropped = true
+	}
+	if !dropped {
+		return
+	}
+	r.record(Record{Type: RecPriceDrop, PriceCts: r.currentPriceCts})
+	payload := map[string]any{
+		"currentPriceCents": r.currentPriceCts,
+	}
+	if r.currentPriceCts > r.auction.FloorPriceCents {
+		payload["nextDropAt"] = r.nextDropAt
+	}
+	r.broadcastCritical(Outbound{Type: "price_drop", RoomID: r.auction.ID, Payload: payload})
+}
+
+// dutchPrice returns an open Dutch auction's price at now and when it next
+// drops. The price is a function of time since opening, so a room loaded
+// after a restart picks up where the clock is rather than where it stopped.
+func dutchPrice(a *Auction, now time.Time) (int64, time.Time) {
+	interval := time.Duration(a.DecrementIntervalSeconds) * time.Second
+	if interval <= 0 {
+		return a.StartPriceCents, now
+	}
+	steps := max(int64(now.Sub(a.StartsAt)/interval), 0)
+	price := max(a.StartPriceCents-steps*a.DecrementCents, a.FloorPriceCents)
+	return price, a.StartsAt.Add(time.Duration(steps+1) * interval)
+}
+
+// processDutchBid treats any place_bid as accepting the current price. The
+// first one wins and closes the auction. A non-zero amount below the current
+// price is rejected so a client never pays more than it saw, and so is any
+// bid while the price is below the reserve, which could not win.
+func (r *Room) processDutchBid(ev Event, now time.Time) {
+	user := ev.User
+	r.dropPrice(now)
+
+	reason := ""
+	if user == nil {
+		reason = "unauthorized"
+	} else if r.auction.Status != StatusOpen {
+		reason = statusRejection(r.auction.Status)
+	} else if ev.AmountCts > 0 && ev.AmountCts < r.currentPriceCts {
+		reason = "below_current_price"
+	} else if r.currentPriceCts < r.auction.ReservePriceCents {
+		reason = "below_reserve"
+	} else {
+		reason = r.hold(user, r.currentPriceCts)
+	}
+
+	r.appendBid(BidView{
+		UserID:         userID(user),
+		Handle:         userHandle(user),
+		AmountCts:      r.currentPriceCts,
+		Accepted:       reason == "",
+		Reason:         reason,
+		CreatedAt:      now,
+		IdempotencyKey: ev.IdempotencyKey,
+	})
+
+	if reason != "" {
+		r.nack(ev, reason)
+		return
+	}
+
+	r.leader = user
+	r.ack(ev, map[string]any{"amountCents": r.currentPriceCts})
+	r.broadcastCritical(Outbound{
+		Type:   "auction_won",
+		RoomID: r.auction.ID,
+		Payload: map[string]any{
+			"amountCents":  r.currentPriceCts,
+			"winnerUserId": user.ID,
+			"winnerHandle": user.Handle,
+		},
+	})
+	r.close(now)
+}
@@ -0,0 +1,85 @@
+package auction
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDutchPrice(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := &Auction{
+		StartsAt: start, StartPriceCents: 1000, DecrementCents: 100,
+		DecrementIntervalSeconds: 60, FloorPriceCents: 650,
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		wantCts  int64
+		wantNext time.Time
+	}{
+		{"before opening", start.Add(-time.Minute), 1000, start.Add(time.Minute)},
+		{"at opening", start, 1000, start.Add(time.Minute)},
+		{"just before the first drop", start.Add(59 * time.Second), 1000, start.Add(time.Minute)},
+		{"after two drops", start.Add(150 * time.Second), 800, start.Add(3 * time.Minute)},
+		{"stops at the floor", start.Add(time.Hour), 650, start.Add(61 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, next := dutchPrice(a, tt.now)
+			if price != tt.wantCts || !next.Equal(tt.wantNext) {
+				t.Errorf("got %d next %v, want %d next %v", price, next, tt.wantCts, tt.wantNext)
+			}
+		})
+	}
+}
+
+// roomPrice reads the current price from the snapshot a new subscriber gets.
+func roomPrice(t *testing.T, r *Room) int64 {
+	t.Helper()
+	_, ch, cancel := r.Subscribe()
+	defer cancel()
+	return (<-ch).Payload.(RoomState).CurrentPriceCts
+}
+
+func TestDutchPriceFallsWhileDown(t *testing.T) {
+	a := &Auction{
+		ID: "a", Format: FormatDutch, Status: StatusOpen,
+		StartsAt: time.Now().UTC().Add(-5*time.Minute - time.Second), EndsAt: time.Now().UTC().Add(time.Hour),
+		StartPriceCents: 1000, DecrementCents: 100, DecrementIntervalSeconds: 60,
+	}
+	t.Run("from the journal", func(t *testing.T) {
+		dir := t.TempDir()
+		lines := journalLines(t,
+			Record{Seq: 1, Type: RecAuctionCreated, AuctionID: "a", Auction: a},
+			Record{Seq: 2, Type: RecPriceDrop, AuctionID: "a", PriceCts: 900},
+		)
+		if err := os.WriteFile(filepath.Join(dir, journalFile), []byte(lines), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		j, err := OpenJournal(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer j.Close()
+		store := NewMemoryStore()
+		m := NewManager(store, store)
+		if err := m.Recover(j); err != nil {
+			t.Fatal(err)
+		}
+		if got := roomPrice(t, m.RoomFor("a")); got != 500 {
+			t.Errorf("got price %d, want 500", got)
+		}
+	})
+	t.Run("from the stores", func(t *testing.T) {
+		store := NewMemoryStore()
+		if err := store.PutAuction(a); err != nil {
+			t.Fatal(err)
+		}
+		m := NewManager(store, store)
+		if got := roomPrice(t, m.RoomFor("a")); got != 500 {
+			t.Errorf("got price %d, want 500", got)
+		}
+	})
+}
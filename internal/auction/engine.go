@@ -2,7 +2,10 @@ package auction
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"math/rand/v2"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -14,19 +17,39 @@ type Event struct {
 	User      *User           `json:"user,omitempty"`
 	AmountCts int64           `json:"amountCents,omitempty"`
 	Payload   json.RawMessage `json:"payload,omitempty"`
+	// ClientMsgID is echoed in the ack or nack sent to Reply.
+	ClientMsgID string `json:"clientMsgId,omitempty"`
+	// IdempotencyKey, when set on a bid, makes repeats from the same user
+	// get the first reply instead of bidding again.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// Reply, when set, receives the sender's ack or nack. The room never
+	// blocks on it.
+	Reply chan<- Outbound `json:"-"`
 }
 
 // Outbound messages broadcast to subscribers.
 type Outbound struct {
-	Type    string      `json:"type"`
-	RoomID  string      `json:"roomId"`
+	Type   string `json:"type"`
+	RoomID string `json:"roomId"`
+	// Seq numbers the room's broadcasts from 1. Snapshots sent on subscribe
+	// carry the seq they are current as of; replies to one client carry none.
+	Seq int64 `json:"seq,omitempty"`
+	// Epoch names the run of the room that numbered Seq. Seq starts over
+	// whenever the room is loaded again, after a restart or a move to
+	// another node, under a new epoch.
+	Epoch   string      `json:"epoch,omitempty"`
 	Payload interface{} `json:"payload,omitempty"`
 }
 
-// Public snapshot of room state for UI.
+// Public snapshot of room state for UI. Subscribers get one on joining and
+// RoomPatch updates after that.
 type RoomState struct {
+	// Version is the last RoomPatch this snapshot includes.
+	Version          int64             `json:"version"`
 	AuctionID        string            `json:"auctionId"`
 	Title            string            `json:"title"`
+	Format           Format            `json:"format"`
+	Status           Status            `json:"status"`
 	CurrentPriceCts  int64             `json:"currentPriceCents"`
 	LeaderUserID     string            `json:"leaderUserId,omitempty"`
 	LeaderHandle     string            `json:"leaderHandle,omitempty"`
@@ -36,86 +59,317 @@ type RoomState struct {
 	Participants     int               `json:"participants"`
 	ParticipantsList []ParticipantView `json:"participantsList"`
 	ReservePriceCts  int64             `json:"reservePriceCents"`
-	BidHistory       []BidView         `json:"bidHistory"`
+	// BidHistory is the latest HistoryLimit bids; older ones are served by
+	// the bid history API.
+	BidHistory   []BidView `json:"bidHistory"`
+	HistoryLimit int       `json:"historyLimit"`
+	// SealedBids counts bidders in a sealed auction while amounts are hidden.
+	SealedBids int `json:"sealedBids,omitempty"`
 }
 
 type BidView struct {
+	// Seq numbers bids within an auction from 1; stores key on it.
+	Seq       int64     `json:"seq"`
 	UserID    string    `json:"userId"`
 	Handle    string    `json:"handle"`
 	AmountCts int64     `json:"amountCents"`
 	Accepted  bool      `json:"accepted"`
 	Reason    string    `json:"reason,omitempty"`
+	Auto      bool      `json:"auto,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
+	// IdempotencyKey is the key the bid was placed with. The journal and
+	// the stores keep it so retries are answered after a restart or a move;
+	// clients never see it.
+	IdempotencyKey string `json:"-"`
 }
 
-// Manager holds auctions and lazily creates rooms.
+var (
+	ErrNotFound     = errors.New("auction not found")
+	ErrAuctionFinal = errors.New("auction already finished")
+	ErrNotSettled   = errors.New("auction not settled")
+	// ErrBidsSealed refuses bid history of a sealed auction before close.
+	ErrBidsSealed = errors.New("bids sealed until close")
+)
+
+// DefaultHistoryLimit is how many recent bids a room keeps in memory and
+// sends in room state.
+const DefaultHistoryLimit = 50
+
+// Manager owns the rooms of live auctions. Auctions, settlements and bids
+// live in the stores; each room mutates its own copy of the auction and
+// writes it through, so readers only ever see stored copies.
 type Manager struct {
-	mu       sync.RWMutex
-	auctions map[string]*Auction
-	rooms    map[string]*Room
+	mu    sync.Mutex
+	store AuctionStore
+	bids  BidStore
+	rooms map[string]*Room
+	// journal, when set, durably records every state change; see Recover.
+	journal *Journal
+	// funds, when set, holds bidders' money for leading bids; see UseFunds.
+	funds Funds
+	// historyLimit caps each room's in-memory bid history.
+	historyLimit int
+	// placement, when set, decides which rooms run on this node; see
+	// UsePlacement.
+	placement Placement
 }
 
-func NewManager() *Manager {
+func NewManager(store AuctionStore, bids BidStore) *Manager {
 	return &Manager{
-		auctions: make(map[string]*Auction),
-		rooms:    make(map[string]*Room),
+		store:        store,
+		bids:         bids,
+		rooms:        make(map[string]*Room),
+		historyLimit: DefaultHistoryLimit,
 	}
 }
 
-func (m *Manager) List() []*Auction {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	out := make([]*Auction, 0, len(m.auctions))
-	for _, a := range m.auctions {
-		out = append(out, a)
-	}
-	return out
+// SetHistoryLimit changes how many recent bids rooms keep; the full history
+// stays in the BidStore. Call it before serving traffic.
+func (m *Manager) SetHistoryLimit(n int) {
+	m.historyLimit = max(n, 1)
+}
+
+func (m *Manager) List() ([]*Auction, error) {
+	return m.store.ListAuctions()
 }
 
-func (m *Manager) Get(id string) (*Auction, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	a, ok := m.auctions[id]
-	return a, ok
+func (m *Manager) Get(id string) (*Auction, error) {
+	return m.store.GetAuction(id)
 }
 
-func (m *Manager) Create(p CreateAuctionParams) *Auction {
+// Create registers the auction and starts its room right away so the
+// lifecycle advances even if nobody ever joins.
+func (m *Manager) Create(p CreateAuctionParams) (*Auction, error) {
 	now := time.Now().UTC()
 	id := strconv.FormatInt(now.Unix(), 10) + "-" + strconv.Itoa(rand.IntN(999999))
+	startsAt := now.Add(time.Duration(p.StartDelaySeconds) * time.Second)
+	format := p.Format
+	if format == "" {
+		format = FormatEnglish
+	}
+	status := StatusOpen
+	if startsAt.After(now) {
+		status = StatusScheduled
+	}
 	a := &Auction{
 		ID:                id,
 		Title:             p.Title,
+		Format:            format,
+		Status:            status,
 		StartPriceCents:   p.StartPriceCents,
 		MinIncrementCents: p.MinIncrementCents,
 		ReservePriceCents: p.ReservePriceCents,
-		EndsAt:            now.Add(time.Duration(p.DurationSeconds) * time.Second),
+		StartsAt:          startsAt,
+		EndsAt:            startsAt.Add(time.Duration(p.DurationSeconds) * time.Second),
 		SoftCloseSeconds:  p.SoftCloseSeconds,
 		CreatedAt:         now,
 	}
+	if format == FormatDutch {
+		a.DecrementCents = p.DecrementCents
+		a.DecrementIntervalSeconds = max(p.DecrementIntervalSeconds, 1)
+		a.FloorPriceCents = p.FloorPriceCents
+	}
+	cp := *a
+	if err := m.store.PutAuction(&cp); err != nil {
+		return nil, err
+	}
+	m.record(Record{Type: RecAuctionCreated, AuctionID: a.ID, Auction: &cp})
+	if _, local := m.Owner(a.ID); !local {
+		// The owner starts the room from the store on its next Rebalance.
+		return &cp, nil
+	}
+	r := newRoom(m, a)
 	m.mu.Lock()
-	m.auctions[a.ID] = a
+	m.rooms[a.ID] = r
 	m.mu.Unlock()
-	return a
+	go r.run()
+	return &cp, nil
+}
+
+// Recover rebuilds auctions, settlements and room state from the journal and
+// journals every change from then on. The stores are reseeded from the
+// journal; bids are keyed by sequence so records they already hold are
+// skipped. Rooms are started for unfinished auctions only, including ones
+// that crashed between closing and settling. With Durable stores, finished
+// auctions are dropped from the journal's snapshots once the stores hold
+// all of them. Call it once, before serving traffic.
+func (m *Manager) Recover(j *Journal) error {
+	var rooms []*Room
+	recovered := 0
+	m.mu.Lock()
+	for _, img := range j.images() {
+		a := img.Auction
+		if err := m.store.PutAuction(&a); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		if img.Settlement != nil {
+			if err := m.store.PutSettlement(img.Settlement); err != nil {
+				m.mu.Unlock()
+				return err
+			}
+		}
+		for _, b := range img.Bids {
+			if err := m.bids.AppendBid(a.ID, b); err != nil {
+				m.mu.Unlock()
+				return err
+			}
+		}
+		recovered++
+		r := newRoom(m, &a)
+		r.restore(img)
+		if r.auction.Status.Final() {
+			continue
+		}
+		m.rooms[a.ID] = r
+		rooms = append(rooms, r)
+	}
+	m.journal = j
+	m.mu.Unlock()
+	if durable(m.store) && durable(m.bids) {
+		j.pruneWith(m.stored)
+	}
+	for _, r := range rooms {
+		go r.run()
+	}
+	log.Printf("journal: recovered %d auctions, %d live", recovered, len(rooms))
+	return nil
+}
+
+// stored reports whether the stores hold everything the journal knows about
+// a finished auction, so the journal may forget it.
+func (m *Manager) stored(img *roomImage) bool {
+	a, err := m.store.GetAuction(img.Auction.ID)
+	if err != nil || a.Status != img.Auction.Status {
+		return false
+	}
+	if img.Settlement != nil {
+		if _, err := m.store.GetSettlement(a.ID); err != nil {
+			return false
+		}
+	}
+	bids, err := m.bids.ListBids(a.ID)
+	return err == nil && len(bids) >= len(img.Bids)
+}
+
+// ResumeRooms starts rooms for every stored auction that has not finished,
+// so they open and close on time after a restart. That includes auctions
+// that crashed between closing and settling; their rooms settle them.
+func (m *Manager) ResumeRooms() error {
+	auctions, err := m.store.ListUnfinishedAuctions()
+	if err != nil {
+		return err
+	}
+	for _, a := range auctions {
+		m.RoomFor(a.ID)
+	}
+	return nil
+}
+
+// record appends to the journal when one is configured. Failures are logged
+// rather than surfaced: the room keeps serving from memory.
+func (m *Manager) record(rec Record) {
+	if m.journal == nil {
+		return
+	}
+	if err := m.journal.Append(rec); err != nil {
+		log.Printf("journal append %s %s: %v", rec.Type, rec.AuctionID, err)
+	}
+}
+
+// Cancel stops an auction that has not finished yet. The transition itself is
+// applied by the room goroutine.
+func (m *Manager) Cancel(id string) error {
+	a, err := m.store.GetAuction(id)
+	if err != nil {
+		return err
+	}
+	if a.Status.Final() {
+		return ErrAuctionFinal
+	}
+	r := m.RoomFor(id)
+	if r == nil {
+		return ErrNotFound
+	}
+	r.Input() <- Event{Type: "cancel_auction"}
+	return nil
 }
 
+// Bids returns a page of an auction's full bid history. Sealed auctions
+// keep theirs hidden until they finish.
+func (m *Manager) Bids(id string, q BidQuery) ([]BidView, error) {
+	a, err := m.store.GetAuction(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.Format.Sealed() && !a.Status.Final() {
+		return nil, ErrBidsSealed
+	}
+	return m.bids.QueryBids(id, q)
+}
+
+// Result returns the settlement of a closed auction.
+func (m *Manager) Result(id string) (*Settlement, error) {
+	if _, err := m.store.GetAuction(id); err != nil {
+		return nil, err
+	}
+	return m.store.GetSettlement(id)
+}
+
+// RoomFor returns the auction's room, loading it from the stores on first use.
+// It returns nil for rooms another node owns.
 func (m *Manager) RoomFor(id string) *Room {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if r, ok := m.rooms[id]; ok {
 		return r
 	}
-	a, ok := m.auctions[id]
-	if !ok {
+	if _, local := m.Owner(id); !local {
 		return nil
 	}
-	r := newRoom(a)
+	a, err := m.store.GetAuction(id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("load auction %s: %v", id, err)
+		}
+		return nil
+	}
+	img, err := m.loadImage(a)
+	if err != nil {
+		log.Printf("load room %s: %v", id, err)
+		return nil
+	}
+	r := newRoom(m, a)
+	r.restore(img)
 	m.rooms[id] = r
 	go r.run()
 	return r
 }
 
+// loadImage rebuilds a room's durable state from the stores. Proxy ceilings
+// are only kept by the journal and do not survive a restart without it.
+func (m *Manager) loadImage(a *Auction) (roomImage, error) {
+	img := roomImage{Auction: *a, PriceCts: a.StartPriceCents}
+	bids, err := m.bids.ListBids(a.ID)
+	if err != nil {
+		return img, err
+	}
+	for _, b := range bids {
+		img.applyBid(b)
+	}
+	s, err := m.store.GetSettlement(a.ID)
+	switch {
+	case err == nil:
+		img.Settlement = s
+	case !errors.Is(err, ErrNotSettled):
+		return img, err
+	}
+	return img, nil
+}
+
 // Room serializes all mutations to one goroutine and fan-outs updates to subscribers.
 type Room struct {
+	mgr     *Manager
 	auction *Auction
 
 	// dynamic state
@@ -123,6 +377,17 @@ type Room struct {
 	leader          *User
 	participants    map[string]*User
 	bidHistory      []BidView
+	bidSeq          int64
+	// acceptedBids counts accepted bids, including those trimmed from
+	// bidHistory.
+	acceptedBids int
+	maxBids      map[string]*maxBid
+	maxBidSeq    int
+	sealedBids   map[string]BidView
+	ranking      []BidView
+	nextDropAt   time.Time
+	// holds marks users with funds held on this auction.
+	holds map[string]bool
 
 	// wiring
 	input       chan Event
@@ -130,79 +395,288 @@ type Room struct {
 	nextSubID   int
 	subReq      chan subscribeRequest
 	unsubReq    chan int
+	// seq is the last broadcast's sequence number in this epoch; replay
+	// keeps the tail for clients resuming after a reconnect.
+	epoch  string
+	seq    int64
+	replay replayBuffer
+	// stateVersion counts room_patch broadcasts; sent is the state they
+	// were diffed against.
+	stateVersion int64
+	sent         sentState
+	// done closes when the room stops because another node took it over.
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
 type subscribeRequest struct {
-	resp chan subscribeResponse
+	// epoch and lastSeq name the last broadcast the client saw; an empty
+	// epoch is a fresh subscription that starts from a snapshot.
+	epoch   string
+	lastSeq int64
+	resp    chan subscribeResponse
 }
 type subscribeResponse struct {
 	id int
 	ch chan Outbound
 }
 
-func newRoom(a *Auction) *Room {
+func newRoom(m *Manager, a *Auction) *Room {
 	return &Room{
+		mgr:             m,
 		auction:         a,
 		currentPriceCts: a.StartPriceCents,
 		participants:    make(map[string]*User),
+		maxBids:         make(map[string]*maxBid),
+		sealedBids:      make(map[string]BidView),
+		holds:           make(map[string]bool),
+		nextDropAt:      a.StartsAt.Add(time.Duration(a.DecrementIntervalSeconds) * time.Second),
 		input:           make(chan Event, 4096),
 		subscribers:     make(map[int]chan Outbound),
 		subReq:          make(chan subscribeRequest),
 		unsubReq:        make(chan int),
+		done:            make(chan struct{}),
+		epoch:           strconv.FormatUint(rand.Uint64(), 36),
 	}
 }
 
 func (r *Room) run() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
+	tick := ticker.C
+	r.advance(time.Now().UTC())
 	for {
 		select {
 		case ev := <-r.input:
 			r.handle(ev)
 		case req := <-r.subReq:
-			ch := make(chan Outbound, 256)
-			id := r.nextSubID
-			r.nextSubID++
-			r.subscribers[id] = ch
-			// Send an immediate snapshot to new subscriber to avoid waiting for next tick.
-			state := r.buildState()
-			select {
-			case ch <- Outbound{Type: "room_state", RoomID: r.auction.ID, Payload: state}:
-			default:
-			}
-			req.resp <- subscribeResponse{id: id, ch: ch}
+			req.resp <- r.subscribe(req.epoch, req.lastSeq)
 		case id := <-r.unsubReq:
 			if ch, ok := r.subscribers[id]; ok {
 				delete(r.subscribers, id)
 				close(ch)
 			}
-		case <-ticker.C:
+		case <-r.done:
+			r.shutdown()
+			return
+		case <-tick:
+			now := time.Now().UTC()
+			r.advance(now)
+			if r.auction.Format == FormatDutch {
+				r.dropPrice(now)
+			}
+			if r.auction.Status.Final() {
+				// Nothing changes any more; keep serving subscribers but stop ticking.
+				ticker.Stop()
+				tick = nil
+				continue
+			}
 			// periodic state broadcast
 			r.broadcastState()
-			// check closure
-			if time.Now().UTC().After(r.auction.EndsAt) {
-				// closed - continue broadcasting state; logic to stop could be added
+		}
+	}
+}
+
+// advance applies any time-driven status transitions.
+func (r *Room) advance(now time.Time) {
+	switch r.auction.Status {
+	case StatusScheduled:
+		if !now.Before(r.auction.StartsAt) {
+			r.setStatus(StatusOpen)
+			// Dutch prices drop on the clock from StartsAt, as dutchPrice
+			// computes after a restart.
+			_, r.nextDropAt = dutchPrice(r.auction, r.auction.StartsAt)
+			r.broadcastCritical(Outbound{Type: "auction_opened", RoomID: r.auction.ID, Payload: map[string]any{"endsAt": r.auction.EndsAt}})
+			r.broadcastState()
+		}
+	case StatusOpen:
+		if now.After(r.auction.EndsAt) {
+			r.close(now)
+		}
+	case StatusClosing:
+		// Only reachable after recovering from a crash mid-close.
+		r.close(now)
+	}
+}
+
+// close moves an open auction through closing and closed, records the
+// settlement with the manager and announces the outcome.
+func (r *Room) close(now time.Time) {
+	r.setStatus(StatusClosing)
+	if r.auction.Format.Sealed() {
+		r.revealSealed()
+	}
+	s := r.settlement(now)
+	r.setStatus(StatusClosed)
+	r.record(Record{Type: RecClose, Settlement: s})
+	// Store the record before flipping to settled so readers never see a
+	// settled auction without it.
+	if err := r.mgr.store.PutSettlement(s); err != nil {
+		log.Printf("store settlement %s: %v", r.auction.ID, err)
+	}
+	r.settleFunds(s)
+	r.updateAuction(func(a *Auction) { a.Status = StatusSettled })
+	r.broadcastCritical(Outbound{Type: "auction_closed", RoomID: r.auction.ID, Payload: s})
+	r.broadcastState()
+}
+
+func (r *Room) settlement(now time.Time) *Settlement {
+	s := &Settlement{
+		AuctionID:         r.auction.ID,
+		ReservePriceCents: r.auction.ReservePriceCents,
+		ClosedAt:          now,
+		Ranking:           r.ranking,
+	}
+	s.BidCount = r.acceptedBids
+	if r.leader == nil {
+		return s
+	}
+	s.HighBidCents = r.currentPriceCts
+	if len(r.ranking) > 0 {
+		s.HighBidCents = r.ranking[0].AmountCts
+	}
+	if r.currentPriceCts >= r.auction.ReservePriceCents {
+		s.ReserveMet = true
+		s.WinnerUserID = r.leader.ID
+		s.WinnerHandle = r.leader.Handle
+		s.HammerPriceCents = r.currentPriceCts
+	}
+	return s
+}
+
+func (r *Room) cancel() {
+	if r.auction.Status.Final() {
+		return
+	}
+	r.setStatus(StatusCancelled)
+	r.settleFunds(nil)
+	r.broadcastCritical(Outbound{Type: "auction_cancelled", RoomID: r.auction.ID})
+	r.broadcastState()
+}
+
+func (r *Room) setStatus(s Status) {
+	r.record(Record{Type: RecStatus, Status: s})
+	r.updateAuction(func(a *Auction) { a.Status = s })
+}
+
+// updateAuction changes the room's private copy and writes it through to
+// the store.
+func (r *Room) updateAuction(fn func(a *Auction)) {
+	fn(r.auction)
+	cp := *r.auction
+	if err := r.mgr.store.PutAuction(&cp); err != nil {
+		log.Printf("store auction %s: %v", r.auction.ID, err)
+	}
+}
+
+// record journals a change to this room. It must run before the change is
+// broadcast so clients never see state a restart would lose.
+func (r *Room) record(rec Record) {
+	rec.AuctionID = r.auction.ID
+	r.mgr.record(rec)
+}
+
+// appendBid numbers a bid, adds it to the history, journals it and writes it
+// to the bid store. It returns the numbered bid.
+func (r *Room) appendBid(b BidView) BidView {
+	r.bidSeq++
+	b.Seq = r.bidSeq
+	r.bidHistory = append(r.bidHistory, b)
+	if n := len(r.bidHistory) - r.mgr.historyLimit; n > 0 {
+		r.bidHistory = r.bidHistory[n:]
+	}
+	if b.Accepted {
+		r.acceptedBids++
+	}
+	typ := RecBidRejected
+	if b.Accepted {
+		typ = RecBidAccepted
+	}
+	r.record(Record{Type: typ, Bid: &b, IdempotencyKey: b.IdempotencyKey, At: b.CreatedAt})
+	if err := r.mgr.bids.AppendBid(r.auction.ID, b); err != nil {
+		log.Printf("store bid %s/%d: %v", r.auction.ID, b.Seq, err)
+	}
+	return b
+}
+
+// restore loads recovered state into a room that has not started running.
+func (r *Room) restore(img roomImage) {
+	if r.auction.Status == StatusClosed && img.Settlement == nil {
+		// Crashed between closing and settling; the room closes it again.
+		r.auction.Status = StatusClosing
+	}
+	r.currentPriceCts = img.PriceCts
+	r.leader = img.Leader
+	for _, b := range img.Bids {
+		r.bidSeq = max(r.bidSeq, b.Seq)
+		if b.Accepted {
+			r.acceptedBids++
+		}
+	}
+	tail := img.Bids[max(len(img.Bids)-r.mgr.historyLimit, 0):]
+	r.bidHistory = append([]BidView(nil), tail...)
+	for _, mb := range img.MaxBids {
+		r.maxBids[mb.User.ID] = &maxBid{user: mb.User, maxCts: mb.MaxCts, seq: mb.Seq}
+		r.maxBidSeq = max(r.maxBidSeq, mb.Seq)
+	}
+	if r.auction.Format.Sealed() {
+		for _, b := range img.Bids {
+			if b.Accepted {
+				r.sealedBids[b.UserID] = b
 			}
 		}
+		if img.Settlement != nil {
+			r.revealSealed()
+		}
+	}
+	if !r.auction.Status.Final() {
+		// Holds outlive restarts in the wallet; track the ones this room owns.
+		if r.leader != nil {
+			r.holds[r.leader.ID] = true
+		}
+		for id := range r.sealedBids {
+			r.holds[id] = true
+		}
+	}
+	if r.auction.Format == FormatDutch {
+		if r.leader != nil && !r.auction.Status.Final() {
+			// The winning bid was journaled but the close was not.
+			r.auction.Status = StatusClosing
+		}
+		if r.auction.Status == StatusOpen {
+			// The price kept falling while the room was down.
+			r.currentPriceCts, r.nextDropAt = dutchPrice(r.auction, time.Now().UTC())
+		}
 	}
 }
 
 func (r *Room) handle(ev Event) {
 	switch ev.Type {
-	case "join_room":
+	case "join_room", "subscribe", "resume":
 		if ev.User != nil {
 			r.participants[ev.User.ID] = ev.User
 		}
+		r.ack(ev, nil)
 		// Notify presence and state immediately.
 		r.broadcast(Outbound{Type: "presence", RoomID: r.auction.ID, Payload: map[string]int{"participants": len(r.participants)}})
 		r.broadcastState()
-	case "leave_room":
+	case "leave_room", "unsubscribe":
 		if ev.User != nil {
 			delete(r.participants, ev.User.ID)
 		}
+		r.ack(ev, nil)
 		r.broadcast(Outbound{Type: "presence", RoomID: r.auction.ID, Payload: map[string]int{"participants": len(r.participants)}})
 	case "place_bid":
+		if r.replayBid(ev) {
+			return
+		}
 		r.processBid(ev)
+	case "set_max_bid":
+		r.processMaxBid(ev)
+	case "snapshot":
+		r.sendSnapshot(ev)
+	case "cancel_auction":
+		r.cancel()
 	}
 }
 
@@ -211,81 +685,168 @@ func (r *Room) processBid(ev Event) {
 	user := ev.User
 	amount := ev.AmountCts
 	reason := ""
-	accepted := false
+
+	// Settle any pending transition first so a bid landing between ticks
+	// cannot slip in after EndsAt.
+	r.advance(now)
+
+	switch {
+	case r.auction.Format.Sealed():
+		r.processSealedBid(ev, now)
+		return
+	case r.auction.Format == FormatDutch:
+		r.processDutchBid(ev, now)
+		return
+	}
 
 	if user == nil {
 		reason = "unauthorized"
-	} else if now.After(r.auction.EndsAt) {
-		reason = "auction_closed"
+	} else if r.auction.Status != StatusOpen {
+		reason = statusRejection(r.auction.Status)
 	} else if amount < r.currentPriceCts+r.auction.MinIncrementCents {
 		reason = "below_min_increment"
 	} else {
-		// accept
-		accepted = true
-		r.currentPriceCts = amount
-		r.leader = user
-		// anti-sniping
-		if r.auction.SoftCloseSeconds > 0 {
-			remaining := time.Until(r.auction.EndsAt)
-			if remaining <= time.Duration(r.auction.SoftCloseSeconds)*time.Second {
-				r.auction.EndsAt = r.auction.EndsAt.Add(time.Duration(r.auction.SoftCloseSeconds) * time.Second)
-			}
-		}
+		reason = r.hold(user, amount)
 	}
 
-	entry := BidView{
-		UserID:    userID(user),
-		Handle:    userHandle(user),
-		AmountCts: amount,
-		Accepted:  accepted,
-		Reason:    reason,
-		CreatedAt: now,
-	}
-	r.bidHistory = append(r.bidHistory, entry)
-
-	if accepted {
-		r.broadcastCritical(Outbound{
-			Type:   "bid_accepted",
-			RoomID: r.auction.ID,
-			Payload: map[string]any{
-				"amountCents":  amount,
-				"leaderUserId": user.ID,
-				"leaderHandle": user.Handle,
-				"endsAt":       r.auction.EndsAt,
-			},
-		})
-		r.broadcastState()
-	} else {
-		r.broadcast(Outbound{
-			Type:   "bid_rejected",
-			RoomID: r.auction.ID,
-			Payload: map[string]any{
-				"reason": reason,
-			},
+	if reason != "" {
+		r.appendBid(BidView{
+			UserID:         userID(user),
+			Handle:         userHandle(user),
+			AmountCts:      amount,
+			Reason:         reason,
+			CreatedAt:      now,
+			IdempotencyKey: ev.IdempotencyKey,
 		})
+		r.nack(ev, reason)
+		return
+	}
+
+	r.acceptBid(user, amount, now, false, ev.IdempotencyKey)
+	r.ack(ev, map[string]any{"amountCents": amount})
+	// Give registered maximum bids a chance to answer.
+	r.resolveProxies(now)
+}
+
+// acceptBid makes user the leader at amount, applies anti-sniping and
+// announces the new price. auto marks bids placed by the proxy engine; key
+// is the idempotency key of the request that placed the bid, if any.
+// The caller has already placed the hold for amount.
+func (r *Room) acceptBid(user *User, amount int64, now time.Time, auto bool, key string) {
+	if r.leader != nil && r.leader.ID != user.ID {
+		// Outbid: the previous leader's money is free again.
+		r.release(r.leader.ID)
+	}
+	r.currentPriceCts = amount
+	r.leader = user
+	// anti-sniping
+	if r.auction.SoftCloseSeconds > 0 {
+		remaining := time.Until(r.auction.EndsAt)
+		if remaining <= time.Duration(r.auction.SoftCloseSeconds)*time.Second {
+			endsAt := r.auction.EndsAt.Add(time.Duration(r.auction.SoftCloseSeconds) * time.Second)
+			r.record(Record{Type: RecExtension, EndsAt: &endsAt})
+			r.updateAuction(func(a *Auction) { a.EndsAt = endsAt })
+		}
+	}
+
+	r.appendBid(BidView{
+		UserID:         user.ID,
+		Handle:         user.Handle,
+		AmountCts:      amount,
+		Accepted:       true,
+		Auto:           auto,
+		CreatedAt:      now,
+		IdempotencyKey: key,
+	})
+
+	r.broadcastCritical(Outbound{
+		Type:   "bid_accepted",
+		RoomID: r.auction.ID,
+		Payload: map[string]any{
+			"amountCents":  amount,
+			"leaderUserId": user.ID,
+			"leaderHandle": user.Handle,
+			"endsAt":       r.auction.EndsAt,
+			"auto":         auto,
+		},
+	})
+	r.broadcastState()
+}
+
+// ack tells the sender of ev that it was applied; payload adds details
+// such as the accepted amount.
+func (r *Room) ack(ev Event, payload map[string]any) {
+	if payload == nil {
+		payload = map[string]any{}
 	}
+	r.reply(ev, "ack", payload)
 }
 
+// nack tells the sender of ev why it was refused. Only the sender learns
+// about rejected requests; the rest of the room sees them in the history.
+func (r *Room) nack(ev Event, reason string) {
+	r.reply(ev, "nack", map[string]any{"reason": reason})
+}
+
+func (r *Room) reply(ev Event, typ string, payload map[string]any) {
+	payload["requestType"] = ev.Type
+	if ev.ClientMsgID != "" {
+		payload["clientMsgId"] = ev.ClientMsgID
+	}
+	out := Outbound{Type: typ, RoomID: r.auction.ID, Payload: payload}
+	if ev.Reply == nil {
+		return
+	}
+	select {
+	case ev.Reply <- out:
+	default:
+	}
+}
+
+// broadcastState sends what changed since the last call as a room_patch,
+// or nothing when the state is unchanged.
 func (r *Room) broadcastState() {
-	state := r.buildState()
+	patch, ok := r.sent.diff(r.buildState())
+	if !ok {
+		return
+	}
+	r.stateVersion++
+	patch.Version = r.stateVersion
 	r.broadcast(Outbound{
-		Type:    "room_state",
+		Type:    "room_patch",
 		RoomID:  r.auction.ID,
-		Payload: state,
+		Payload: patch,
 	})
 }
 
+// sendSnapshot replies to ev with the full room state, for clients that
+// missed a patch.
+func (r *Room) sendSnapshot(ev Event) {
+	if ev.Reply == nil {
+		return
+	}
+	select {
+	case ev.Reply <- Outbound{Type: "room_state", RoomID: r.auction.ID, Seq: r.seq, Epoch: r.epoch, Payload: r.buildState()}:
+	default:
+	}
+}
+
 func (r *Room) buildState() RoomState {
 	plist := make([]ParticipantView, 0, len(r.participants))
 	for _, u := range r.participants {
 		if u == nil {
 			continue
 		}
-		plist = append(plist, ParticipantView{UserID: u.ID, Handle: u.Handle})
+		plist = append(plist, ParticipantView{UserID: u.ID, Handle: u.Handle, DisplayName: u.DisplayName, Verified: u.Verified})
 	}
+	// Stable order so patches only carry the list when membership changes.
+	sort.Slice(plist, func(i, j int) bool { return plist[i].UserID < plist[j].UserID })
 	state := RoomState{
+		Version:          r.stateVersion,
 		AuctionID:        r.auction.ID,
 		Title:            r.auction.Title,
+		Format:           r.auction.Format,
+		Status:           r.auction.Status,
 		CurrentPriceCts:  r.currentPriceCts,
 		EndsAt:           r.auction.EndsAt,
 		SoftCloseSeconds: r.auction.SoftCloseSeconds,
@@ -294,26 +855,67 @@ func (r *Room) buildState() RoomState {
 		ParticipantsList: plist,
 		ReservePriceCts:  r.auction.ReservePriceCents,
 		BidHistory:       r.bidHistory,
+		HistoryLimit:     r.mgr.historyLimit,
 	}
 	if r.leader != nil {
 		state.LeaderUserID = r.leader.ID
 		state.LeaderHandle = r.leader.Handle
 	}
+	if r.sealedHidden() {
+		state.BidHistory = []BidView{}
+		state.SealedBids = len(r.sealedBids)
+	}
 	return state
 }
 
+// subscribe registers a subscriber. Resuming clients get the broadcasts
+// they missed after lastSeq; everyone else, clients too far behind for the
+// replay buffer and clients whose seq is from an earlier epoch start from a
+// snapshot.
+func (r *Room) subscribe(epoch string, lastSeq int64) subscribeResponse {
+	var missed []Outbound
+	ok := false
+	if epoch == r.epoch {
+		missed, ok = r.replay.since(lastSeq, r.seq)
+	}
+	ch := make(chan Outbound, max(256, len(missed)+1))
+	id := r.nextSubID
+	r.nextSubID++
+	r.subscribers[id] = ch
+	if ok {
+		for _, msg := range missed {
+			ch <- msg
+		}
+	} else {
+		// Send an immediate snapshot to new subscriber to avoid waiting for next tick.
+		ch <- Outbound{Type: "room_state", RoomID: r.auction.ID, Seq: r.seq, Epoch: r.epoch, Payload: r.buildState()}
+	}
+	return subscribeResponse{id: id, ch: ch}
+}
+
+// sequence numbers msg and keeps it for resuming clients.
+func (r *Room) sequence(msg Outbound) Outbound {
+	r.seq++
+	msg.Seq = r.seq
+	msg.Epoch = r.epoch
+	r.replay.add(msg)
+	return msg
+}
+
 func (r *Room) broadcast(msg Outbound) {
+	msg = r.sequence(msg)
 	for _, ch := range r.subscribers {
 		select {
 		case ch <- msg:
 		default:
-			// drop if subscriber is slow; critical events should be retried by client via next state tick
+			// drop if subscriber is slow; the client notices the gap in seq and resumes
 		}
 	}
 }
 
 // broadcastCritical never silently drops; slow subscribers are evicted.
 func (r *Room) broadcastCritical(msg Outbound) {
+	msg = r.sequence(msg)
 	for id, ch := range r.subscribers {
 		select {
 		case ch <- msg:
@@ -325,13 +927,31 @@ func (r *Room) broadcastCritical(msg Outbound) {
 	}
 }
 
-// Subscribe returns a channel for outbound messages.
+// Subscribe returns a channel for outbound messages, starting with a
+// room_state snapshot.
 func (r *Room) Subscribe() (int, <-chan Outbound, func()) {
-	req := subscribeRequest{resp: make(chan subscribeResponse)}
-	r.subReq <- req
+	return r.Resume("", -1)
+}
+
+// Resume subscribes like Subscribe but first delivers every broadcast after
+// lastSeq of epoch, falling back to a snapshot when they are no longer
+// buffered or the epoch has ended.
+func (r *Room) Resume(epoch string, lastSeq int64) (int, <-chan Outbound, func()) {
+	req := subscribeRequest{epoch: epoch, lastSeq: lastSeq, resp: make(chan subscribeResponse)}
+	select {
+	case r.subReq <- req:
+	case <-r.done:
+		// Moved to another node; the closed stream sends the client there.
+		ch := make(chan Outbound)
+		close(ch)
+		return -1, ch, func() {}
+	}
 	resp := <-req.resp
 	cancel := func() {
-		r.unsubReq <- resp.id
+		select {
+		case r.unsubReq <- resp.id:
+		case <-r.done:
+		}
 	}
 	return resp.id, resp.ch, cancel
 }
@@ -340,6 +960,18 @@ func (r *Room) Input() chan<- Event {
 	return r.input
 }
 
+// statusRejection maps a non-open status to the bid rejection reason.
+func statusRejection(s Status) string {
+	switch s {
+	case StatusScheduled:
+		return "auction_not_open"
+	case StatusCancelled:
+		return "auction_cancelled"
+	default:
+		return "auction_closed"
+	}
+}
+
 func userID(u *User) string {
 	if u == nil {
 		return ""
@@ -0,0 +1,89 @@
+package auction
+
+import (
+	"errors"
+	"log"
+)
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Funds reserves bidders' money for bids that may still win. Rooms call it
+// from their own goroutines, so implementations must be safe for concurrent
+// use. Without one the manager accepts any bid.
+type Funds interface {
+	// CanCover returns ErrInsufficientFunds if the user could not hold cents
+	// on the auction.
+	CanCover(userID, auctionID string, cents int64) error
+	// Hold reserves cents for the user's bid, replacing an earlier hold on
+	// the same auction.
+	Hold(userID, auctionID string, cents int64) error
+	Release(userID, auctionID string) error
+	// Capture charges cents against the user's hold and drops it.
+	Capture(userID, auctionID string, cents int64) error
+}
+
+// UseFunds makes rooms hold funds for leading bids. Call it before serving
+// traffic.
+func (m *Manager) UseFunds(f Funds) {
+	m.funds = f
+}
+
+// fundsRejection maps a Funds error to a bid rejection reason.
+func (r *Room) fundsRejection(err error) string {
+	if errors.Is(err, ErrInsufficientFunds) {
+		return "insufficient_funds"
+	}
+	log.Printf("funds %s: %v", r.auction.ID, err)
+	return "funds_unavailable"
+}
+
+// cover checks the user could pay cents without holding anything; it
+// returns a rejection reason or "".
+func (r *Room) cover(user *User, cents int64) string {
+	if r.mgr.funds == nil {
+		return ""
+	}
+	if err := r.mgr.funds.CanCover(user.ID, r.auction.ID, cents); err != nil {
+		return r.fundsRejection(err)
+	}
+	return ""
+}
+
+// hold reserves cents for user's bid and returns a rejection reason or "".
+func (r *Room) hold(user *User, cents int64) string {
+	if r.mgr.funds == nil {
+		return ""
+	}
+	if err := r.mgr.funds.Hold(user.ID, r.auction.ID, cents); err != nil {
+		return r.fundsRejection(err)
+	}
+	r.holds[user.ID] = true
+	return ""
+}
+
+func (r *Room) release(userID string) {
+	if r.mgr.funds == nil || !r.holds[userID] {
+		return
+	}
+	delete(r.holds, userID)
+	if err := r.mgr.funds.Release(userID, r.auction.ID); err != nil {
+		log.Printf("release funds %s/%s: %v", r.auction.ID, userID, err)
+	}
+}
+
+// settleFunds charges the winner the hammer price and releases every other
+// hold in the room.
+func (r *Room) settleFunds(s *Settlement) {
+	if r.mgr.funds == nil {
+		return
+	}
+	if s != nil && s.WinnerUserID != "" && r.holds[s.WinnerUserID] {
+		delete(r.holds, s.WinnerUserID)
+		if err := r.mgr.funds.Capture(s.WinnerUserID, r.auction.ID, s.HammerPriceCents); err != nil {
+			log.Printf("capture funds %s/%s: %v", r.auction.ID, s.WinnerUserID, err)
+		}
+	}
+	for id := range r.holds {
+		r.release(id)
+	}
+}
@@ -0,0 +1,71 @@
+package auction
+
+import (
+	"context"
+	"log"
+)
+
+// BidResult is the room's decision on a bid placed through PlaceBid.
+type BidResult struct {
+	Accepted  bool   `json:"accepted"`
+	AmountCts int64  `json:"amountCents,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// Replayed marks the stored result of an earlier request with the same
+	// idempotency key.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// PlaceBid sends a bid to the auction's room and waits for its ack or nack.
+// Bids from the same user with the same non-empty key are only applied
+// once; repeats get the first result back. If ctx ends first the bid may
+// still be applied, so callers retry with the same key.
+func (m *Manager) PlaceBid(ctx context.Context, id string, user *User, amountCts int64, key string) (BidResult, error) {
+	r := m.RoomFor(id)
+	if r == nil {
+		return BidResult{}, ErrNotFound
+	}
+	reply := make(chan Outbound, 1)
+	ev := Event{Type: "place_bid", User: user, AmountCts: amountCts, IdempotencyKey: key, Reply: reply}
+	select {
+	case r.Input() <- ev:
+	case <-ctx.Done():
+		return BidResult{}, ctx.Err()
+	}
+	select {
+	case out := <-reply:
+		p, _ := out.Payload.(map[string]any)
+		res := BidResult{Accepted: out.Type == "ack"}
+		res.AmountCts, _ = p["amountCents"].(int64)
+		res.Reason, _ = p["reason"].(string)
+		res.Replayed, _ = p["replayed"].(bool)
+		return res, nil
+	case <-ctx.Done():
+		return BidResult{}, ctx.Err()
+	}
+}
+
+// replayBid answers a repeated keyed bid with the result of the bid the
+// first request placed. Keyed bids are looked up in the BidStore, so the
+// answer survives restarts and moves between nodes.
+func (r *Room) replayBid(ev Event) bool {
+	if ev.IdempotencyKey == "" || ev.User == nil {
+		return false
+	}
+	found, err := r.mgr.bids.QueryBids(r.auction.ID, BidQuery{UserID: ev.User.ID, IdempotencyKey: ev.IdempotencyKey, Limit: 1})
+	if err != nil {
+		// Judging the bid again could apply it twice; let the client retry.
+		log.Printf("idempotency lookup %s: %v", r.auction.ID, err)
+		r.nack(ev, "store_unavailable")
+		return true
+	}
+	if len(found) == 0 {
+		return false
+	}
+	b := found[0]
+	if b.Accepted {
+		r.reply(ev, "ack", map[string]any{"amountCents": b.AmountCts, "replayed": true})
+	} else {
+		r.reply(ev, "nack", map[string]any{"reason": b.Reason, "replayed": true})
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package auction
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPlaceBidReplaysAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	m := NewManager(store, store)
+	if err := m.Recover(j); err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.Create(CreateAuctionParams{Title: "lot", StartPriceCents: 1000, MinIncrementCents: 100, DurationSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &User{ID: "u1", Handle: "u1"}
+	ctx := context.Background()
+	first, err := m.PlaceBid(ctx, a.ID, u, 1500, "k1")
+	if err != nil || !first.Accepted {
+		t.Fatalf("first bid: %+v %v", first, err)
+	}
+	rejected, err := m.PlaceBid(ctx, a.ID, u, 1200, "k2")
+	if err != nil || rejected.Accepted {
+		t.Fatalf("low bid: %+v %v", rejected, err)
+	}
+
+	tests := []struct {
+		name string
+		m    func() *Manager
+	}{
+		{"same room", func() *Manager { return m }},
+		// A node taking the room over reloads it from the shared stores.
+		{"moved", func() *Manager { return NewManager(store, store) }},
+		{"restarted", func() *Manager {
+			s := NewMemoryStore()
+			return restart(t, dir, j, s, s)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.m()
+			res, err := m.PlaceBid(ctx, a.ID, u, 1500, "k1")
+			if err != nil || !res.Accepted || !res.Replayed || res.AmountCts != 1500 {
+				t.Errorf("retry of accepted bid: %+v %v", res, err)
+			}
+			res, err = m.PlaceBid(ctx, a.ID, u, 1200, "k2")
+			if err != nil || res.Accepted || !res.Replayed || res.Reason != rejected.Reason {
+				t.Errorf("retry of rejected bid: %+v %v", res, err)
+			}
+			// Another user's key is their own.
+			other := &User{ID: "u2-" + tt.name, Handle: "u2"}
+			res, err = m.PlaceBid(ctx, a.ID, other, 1600, "k1")
+			if err != nil || res.Replayed {
+				t.Errorf("other user's bid: %+v %v", res, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package auction
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Journal record types.
+const (
+	RecAuctionCreated = "auction_created"
+	RecBidAccepted    = "bid_accepted"
+	RecBidRejected    = "bid_rejected"
+	RecMaxBidSet      = "max_bid_set"
+	RecMaxBidCleared  = "max_bid_cleared"
+	RecExtension      = "extension"
+	RecStatus         = "status"
+	RecPriceDrop      = "price_drop"
+	RecClose          = "close"
+)
+
+// Record is one entry of the append-only event journal. Only the field
+// matching Type is set.
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Type      string    `json:"type"`
+	AuctionID string    `json:"auctionId"`
+	At        time.Time `json:"at"`
+	Auction   *Auction  `json:"auction,omitempty"`
+	Bid       *BidView  `json:"bid,omitempty"`
+	// IdempotencyKey goes with Bid, which leaves it out of its JSON.
+	IdempotencyKey string        `json:"idempotencyKey,omitempty"`
+	MaxBid         *MaxBidRecord `json:"maxBid,omitempty"`
+	EndsAt         *time.Time    `json:"endsAt,omitempty"`
+	Status         Status        `json:"status,omitempty"`
+	PriceCts       int64         `json:"priceCents,omitempty"`
+	Settlement     *Settlement   `json:"settlement,omitempty"`
+}
+
+// MaxBidRecord persists a proxy ceiling. It only ever lives in the journal
+// and the room, never in anything sent to clients.
+type MaxBidRecord struct {
+	User   *User `json:"user"`
+	MaxCts int64 `json:"maxCents"`
+	Seq    int   `json:"seq"`
+}
+
+// roomImage is the durable part of one auction's state, rebuilt by folding
+// journal records.
+type roomImage struct {
+	Auction    Auction        `json:"auction"`
+	PriceCts   int64          `json:"priceCents"`
+	Leader     *User          `json:"leader,omitempty"`
+	Bids       []BidView      `json:"bids"`
+	MaxBids    []MaxBidRecord `json:"maxBids,omitempty"`
+	Settlement *Settlement    `json:"settlement,omitempty"`
+}
+
+// snapshotBid is how snapshots store a bid: BidView leaves its idempotency
+// key out of JSON, but retries after a restart need it.
+type snapshotBid struct {
+	BidView
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+func (img roomImage) MarshalJSON() ([]byte, error) {
+	type plain roomImage
+	bids := make([]snapshotBid, len(img.Bids))
+	for i, b := range img.Bids {
+		bids[i] = snapshotBid{BidView: b, IdempotencyKey: b.IdempotencyKey}
+	}
+	return json.Marshal(struct {
+		plain
+		Bids []snapshotBid `json:"bids"`
+	}{plain(img), bids})
+}
+
+func (img *roomImage) UnmarshalJSON(data []byte) error {
+	type plain roomImage
+	var v struct {
+		plain
+		Bids []snapshotBid `json:"bids"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*img = roomImage(v.plain)
+	img.Bids = make([]BidView, len(v.Bids))
+	for i, b := range v.Bids {
+		img.Bids[i] = b.BidView
+		img.Bids[i].IdempotencyKey = b.IdempotencyKey
+	}
+	return nil
+}
+
+func (img *roomImage) applyBid(b BidView) {
+	img.Bids = append(img.Bids, b)
+	// Sealed bids only set the price once revealed at close.
+	if b.Accepted && !img.Auction.Format.Sealed() {
+		img.PriceCts = b.AmountCts
+		img.Leader = &User{ID: b.UserID, Handle: b.Handle}
+	}
+}
+
+type journalState struct {
+	Seq      uint64                `json:"seq"`
+	Auctions map[string]*roomImage `json:"auctions"`
+}
+
+func (st *journalState) apply(rec Record) {
+	st.Seq = rec.Seq
+	if rec.Type == RecAuctionCreated {
+		if rec.Auction != nil {
+			st.Auctions[rec.AuctionID] = &roomImage{Auction: *rec.Auction, PriceCts: rec.Auction.StartPriceCents}
+		}
+		return
+	}
+	img := st.Auctions[rec.AuctionID]
+	if img == nil {
+		return
+	}
+	switch rec.Type {
+	case RecBidAccepted, RecBidRejected:
+		b := *rec.Bid
+		b.IdempotencyKey = rec.IdempotencyKey
+		img.applyBid(b)
+	case RecMaxBidSet, RecMaxBidCleared:
+		kept := img.MaxBids[:0]
+		for _, mb := range img.MaxBids {
+			if mb.User.ID != rec.MaxBid.User.ID {
+				kept = append(kept, mb)
+			}
+		}
+		img.MaxBids = kept
+		if rec.Type == RecMaxBidSet {
+			img.MaxBids = append(img.MaxBids, *rec.MaxBid)
+		}
+	case RecExtension:
+		img.Auction.EndsAt = *rec.EndsAt
+	case RecStatus:
+		img.Auction.Status = rec.Status
+	case RecPriceDrop:
+		img.PriceCts = rec.PriceCts
+	case RecClose:
+		img.Settlement = rec.Settlement
+		img.Auction.Status = StatusSettled
+	}
+}
+
+// Journal is a file-backed event log with periodic snapshots. Records are
+// fsynced before Append returns; Snapshot folds everything so far into
+// snapshot.json and truncates the log, bounding replay time.
+type Journal struct {
+	mu    sync.Mutex
+	dir   string
+	log   *os.File
+	state *journalState
+	// prunable, when set, tells Snapshot which finished auctions it may
+	// leave out.
+	prunable func(img *roomImage) bool
+}
+
+const (
+	journalFile  = "journal.log"
+	snapshotFile = "snapshot.json"
+)
+
+// OpenJournal loads the latest snapshot and replays the log after it.
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	st := &journalState{Auctions: make(map[string]*roomImage)}
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, fmt.Errorf("snapshot: %w", err)
+		}
+		if st.Auctions == nil {
+			st.Auctions = make(map[string]*roomImage)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	good, err := replay(f, st)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Drop a torn tail left by a crash mid-write so new records start clean.
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Journal{dir: dir, log: f, state: st}, nil
+}
+
+// replay applies records newer than the snapshot and returns the offset just
+// past the last complete record.
+func replay(f *os.File, st *journalState) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	rd := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := rd.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				log.Printf("journal: dropping incomplete record at offset %d", offset)
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("journal: dropping corrupt record at offset %d: %v", offset, err)
+			return offset, nil
+		}
+		offset += int64(len(line))
+		if rec.Seq > st.Seq {
+			st.apply(rec)
+		}
+	}
+}
+
+// Append assigns the next sequence number and durably writes rec.
+func (j *Journal) Append(rec Record) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	rec.Seq = j.state.Seq + 1
+	if rec.At.IsZero() {
+		rec.At = time.Now().UTC()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := j.log.Sync(); err != nil {
+		return err
+	}
+	j.state.apply(rec)
+	return nil
+}
+
+// pruneWith sets how Snapshot tells that a finished auction is stored
+// elsewhere and can be left out.
+func (j *Journal) pruneWith(fn func(img *roomImage) bool) {
+	j.mu.Lock()
+	j.prunable = fn
+	j.mu.Unlock()
+}
+
+// prune forgets settled and cancelled auctions that prunable says are
+// safely stored elsewhere, so snapshots only grow with the live ones. A
+// closed auction still lacking its settlement is kept. Callers hold j.mu.
+func (j *Journal) prune() {
+	if j.prunable == nil {
+		return
+	}
+	for id, img := range j.state.Auctions {
+		done := img.Auction.Status == StatusSettled || img.Auction.Status == StatusCancelled
+		if done && j.prunable(img) {
+			delete(j.state.Auctions, id)
+		}
+	}
+}
+
+// Snapshot writes the folded state atomically and truncates the log.
+func (j *Journal) Snapshot() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.prune()
+	data, err := json.Marshal(j.state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(j.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(j.dir, snapshotFile)); err != nil {
+		return err
+	}
+	// Records up to state.Seq are in the snapshot; replay skips them even if
+	// the truncate below does not happen.
+	if err := j.log.Truncate(0); err != nil {
+		return err
+	}
+	_, err = j.log.Seek(0, io.SeekStart)
+	return err
+}
+
+// SnapshotEvery snapshots on a fixed interval until stop is closed; a nil
+// stop runs for the life of the process.
+func (j *Journal) SnapshotEvery(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := j.Snapshot(); err != nil {
+				log.Printf("journal snapshot: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log.Close()
+}
+
+// images returns copies of every auction's durable state.
+func (j *Journal) images() []roomImage {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]roomImage, 0, len(j.state.Auctions))
+	for _, img := range j.state.Auctions {
+		cp := *img
+		cp.Bids = append([]BidView(nil), img.Bids...)
+		cp.MaxBids = append([]MaxBidRecord(nil), img.MaxBids...)
+		out = append(out, cp)
+	}
+	return out
+}
@@ -0,0 +1,508 @@
+package auction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newState() *journalState {
+	return &journalState{Auctions: make(map[string]*roomImage)}
+}
+
+func created(seq uint64, id string, format Format) Record {
+	return Record{Seq: seq, Type: RecAuctionCreated, AuctionID: id, Auction: &Auction{
+		ID: id, Format: format, Status: StatusOpen, StartPriceCents: 1000,
+	}}
+}
+
+func bid(seq uint64, id, user string, amount int64) Record {
+	return Record{Seq: seq, Type: RecBidAccepted, AuctionID: id, Bid: &BidView{
+		Seq: int64(seq), UserID: user, Handle: user, AmountCts: amount, Accepted: true,
+	}}
+}
+
+func TestJournalStateApply(t *testing.T) {
+	endsAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name  string
+		recs  []Record
+		check func(t *testing.T, img *roomImage)
+	}{
+		{
+			name: "created starts at the start price",
+			recs: []Record{created(1, "a", FormatEnglish)},
+			check: func(t *testing.T, img *roomImage) {
+				if img.PriceCts != 1000 || img.Leader != nil || img.Auction.Status != StatusOpen {
+					t.Errorf("got price %d leader %v status %s", img.PriceCts, img.Leader, img.Auction.Status)
+				}
+			},
+		},
+		{
+			name: "accepted bid sets price and leader",
+			recs: []Record{created(1, "a", FormatEnglish), bid(2, "a", "u1", 1500)},
+			check: func(t *testing.T, img *roomImage) {
+				if img.PriceCts != 1500 || img.Leader == nil || img.Leader.ID != "u1" || len(img.Bids) != 1 {
+					t.Errorf("got price %d leader %v bids %d", img.PriceCts, img.Leader, len(img.Bids))
+				}
+			},
+		},
+		{
+			name: "rejected bid is kept but changes nothing",
+			recs: []Record{created(1, "a", FormatEnglish), {Seq: 2, Type: RecBidRejected, AuctionID: "a",
+				Bid: &BidView{UserID: "u1", AmountCts: 500, Reason: "too_low"}}},
+			check: func(t *testing.T, img *roomImage) {
+				if img.PriceCts != 1000 || img.Leader != nil || len(img.Bids) != 1 {
+					t.Errorf("got price %d leader %v bids %d", img.PriceCts, img.Leader, len(img.Bids))
+				}
+			},
+		},
+		{
+			name: "sealed bid does not reveal the price",
+			recs: []Record{created(1, "a", FormatSealedFirstPrice), bid(2, "a", "u1", 1500)},
+			check: func(t *testing.T, img *roomImage) {
+				if img.PriceCts != 1000 || img.Leader != nil || len(img.Bids) != 1 {
+					t.Errorf("got price %d leader %v bids %d", img.PriceCts, img.Leader, len(img.Bids))
+				}
+			},
+		},
+		{
+			name: "max bid replaces the user's earlier one",
+			recs: []Record{
+				created(1, "a", FormatEnglish),
+				{Seq: 2, Type: RecMaxBidSet, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u1"}, MaxCts: 2000, Seq: 1}},
+				{Seq: 3, Type: RecMaxBidSet, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u2"}, MaxCts: 2500, Seq: 2}},
+				{Seq: 4, Type: RecMaxBidSet, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u1"}, MaxCts: 3000, Seq: 3}},
+			},
+			check: func(t *testing.T, img *roomImage) {
+				if len(img.MaxBids) != 2 {
+					t.Fatalf("got %d max bids, want 2", len(img.MaxBids))
+				}
+				if mb := img.MaxBids[1]; mb.User.ID != "u1" || mb.MaxCts != 3000 {
+					t.Errorf("got last max bid %s %d", mb.User.ID, mb.MaxCts)
+				}
+			},
+		},
+		{
+			name: "cleared max bid is gone",
+			recs: []Record{
+				created(1, "a", FormatEnglish),
+				{Seq: 2, Type: RecMaxBidSet, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u1"}, MaxCts: 2000, Seq: 1}},
+				{Seq: 3, Type: RecMaxBidSet, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u2"}, MaxCts: 2500, Seq: 2}},
+				{Seq: 4, Type: RecMaxBidCleared, AuctionID: "a", MaxBid: &MaxBidRecord{User: &User{ID: "u2"}, MaxCts: 2500, Seq: 2}},
+			},
+			check: func(t *testing.T, img *roomImage) {
+				if len(img.MaxBids) != 1 || img.MaxBids[0].User.ID != "u1" {
+					t.Errorf("got max bids %+v", img.MaxBids)
+				}
+			},
+		},
+		{
+			name: "extension moves the end",
+			recs: []Record{created(1, "a", FormatEnglish), {Seq: 2, Type: RecExtension, AuctionID: "a", EndsAt: &endsAt}},
+			check: func(t *testing.T, img *roomImage) {
+				if !img.Auction.EndsAt.Equal(endsAt) {
+					t.Errorf("got ends at %v", img.Auction.EndsAt)
+				}
+			},
+		},
+		{
+			name: "price drop sets the price",
+			recs: []Record{created(1, "a", FormatDutch), {Seq: 2, Type: RecPriceDrop, AuctionID: "a", PriceCts: 900}},
+			check: func(t *testing.T, img *roomImage) {
+				if img.PriceCts != 900 {
+					t.Errorf("got price %d", img.PriceCts)
+				}
+			},
+		},
+		{
+			name: "close settles",
+			recs: []Record{
+				created(1, "a", FormatEnglish),
+				bid(2, "a", "u1", 1500),
+				{Seq: 3, Type: RecStatus, AuctionID: "a", Status: StatusClosing},
+				{Seq: 4, Type: RecClose, AuctionID: "a", Settlement: &Settlement{AuctionID: "a", WinnerUserID: "u1", HammerPriceCents: 1500}},
+			},
+			check: func(t *testing.T, img *roomImage) {
+				if img.Auction.Status != StatusSettled || img.Settlement == nil || img.Settlement.WinnerUserID != "u1" {
+					t.Errorf("got status %s settlement %+v", img.Auction.Status, img.Settlement)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newState()
+			for _, rec := range tt.recs {
+				st.apply(rec)
+			}
+			if want := tt.recs[len(tt.recs)-1].Seq; st.Seq != want {
+				t.Errorf("got seq %d, want %d", st.Seq, want)
+			}
+			tt.check(t, st.Auctions["a"])
+		})
+	}
+}
+
+func TestJournalStateApplyUnknownAuction(t *testing.T) {
+	st := newState()
+	st.apply(bid(1, "missing", "u1", 1500))
+	st.apply(Record{Seq: 2, Type: RecAuctionCreated, AuctionID: "nil"})
+	if len(st.Auctions) != 0 || st.Seq != 2 {
+		t.Errorf("got %d auctions at seq %d", len(st.Auctions), st.Seq)
+	}
+}
+
+// journalLines encodes recs one per line, as Append writes them.
+func journalLines(t *testing.T, recs ...Record) string {
+	t.Helper()
+	var b strings.Builder
+	for _, rec := range recs {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestReplay(t *testing.T) {
+	whole := journalLines(t, created(1, "a", FormatEnglish), bid(2, "a", "u1", 1500))
+	tests := []struct {
+		name    string
+		content string
+		// snapshot is the state the log is replayed onto; nil is empty.
+		snapshot   func() *journalState
+		wantOffset int64
+		wantSeq    uint64
+		wantPrice  int64
+		wantStatus Status
+	}{
+		{
+			name:       "empty log",
+			content:    "",
+			wantOffset: 0,
+			wantSeq:    0,
+		},
+		{
+			name:       "complete records",
+			content:    whole,
+			wantOffset: int64(len(whole)),
+			wantSeq:    2,
+			wantPrice:  1500,
+			wantStatus: StatusOpen,
+		},
+		{
+			name:       "torn tail is dropped",
+			content:    whole + `{"seq":3,"type":"bid_acc`,
+			wantOffset: int64(len(whole)),
+			wantSeq:    2,
+			wantPrice:  1500,
+			wantStatus: StatusOpen,
+		},
+		{
+			name:       "corrupt record stops replay",
+			content:    whole + "not json\n" + journalLines(t, bid(4, "a", "u2", 2000)),
+			wantOffset: int64(len(whole)),
+			wantSeq:    2,
+			wantPrice:  1500,
+			wantStatus: StatusOpen,
+		},
+		{
+			name:    "records in the snapshot are skipped",
+			content: whole + journalLines(t, bid(3, "a", "u2", 2000)),
+			snapshot: func() *journalState {
+				st := newState()
+				st.apply(created(1, "a", FormatEnglish))
+				st.apply(bid(2, "a", "u1", 1500))
+				return st
+			},
+			wantOffset: int64(len(whole + journalLines(t, bid(3, "a", "u2", 2000)))),
+			wantSeq:    3,
+			wantPrice:  2000,
+			wantStatus: StatusOpen,
+		},
+		{
+			name: "crash mid-close leaves the auction closing",
+			content: whole + journalLines(t, Record{Seq: 3, Type: RecStatus, AuctionID: "a", Status: StatusClosing}) +
+				`{"seq":4,"type":"close","auctionId":"a","settlement":{`,
+			wantOffset: int64(len(whole + journalLines(t, Record{Seq: 3, Type: RecStatus, AuctionID: "a", Status: StatusClosing}))),
+			wantSeq:    3,
+			wantPrice:  1500,
+			wantStatus: StatusClosing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), journalFile)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			st := newState()
+			if tt.snapshot != nil {
+				st = tt.snapshot()
+			}
+			offset, err := replay(f, st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != tt.wantOffset || st.Seq != tt.wantSeq {
+				t.Errorf("got offset %d seq %d, want %d %d", offset, st.Seq, tt.wantOffset, tt.wantSeq)
+			}
+			img := st.Auctions["a"]
+			if tt.wantStatus == "" {
+				if img != nil {
+					t.Errorf("got auction %+v, want none", img.Auction)
+				}
+				return
+			}
+			if img == nil {
+				t.Fatal("auction missing")
+			}
+			if img.PriceCts != tt.wantPrice || img.Auction.Status != tt.wantStatus {
+				t.Errorf("got price %d status %s, want %d %s", img.PriceCts, img.Auction.Status, tt.wantPrice, tt.wantStatus)
+			}
+			if tt.wantStatus == StatusClosing && img.Settlement != nil {
+				t.Errorf("got settlement %+v before close was written", img.Settlement)
+			}
+		})
+	}
+}
+
+func TestOpenJournalTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	whole := journalLines(t, created(1, "a", FormatEnglish))
+	if err := os.WriteFile(filepath.Join(dir, journalFile), []byte(whole+`{"seq":2`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(bid(0, "a", "u1", 1500)); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	img := j.state.Auctions["a"]
+	if j.state.Seq != 2 || img == nil || img.PriceCts != 1500 {
+		t.Errorf("got seq %d image %+v", j.state.Seq, img)
+	}
+}
+
+func TestSnapshotPrunesStoredFinishedAuctions(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := []Record{
+		created(0, "settled", FormatEnglish),
+		{Type: RecClose, AuctionID: "settled", Settlement: &Settlement{AuctionID: "settled"}},
+		created(0, "closed", FormatEnglish),
+		{Type: RecStatus, AuctionID: "closed", Status: StatusClosed},
+		created(0, "open", FormatEnglish),
+	}
+	for _, rec := range recs {
+		if err := j.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.pruneWith(func(*roomImage) bool { return true })
+	if err := j.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if _, ok := j.state.Auctions["settled"]; ok {
+		t.Error("settled auction kept")
+	}
+	// Closed without a settlement is not finished yet.
+	for _, id := range []string{"closed", "open"} {
+		if _, ok := j.state.Auctions[id]; !ok {
+			t.Errorf("%s auction pruned", id)
+		}
+	}
+	if j.state.Seq != uint64(len(recs)) {
+		t.Errorf("got seq %d, want %d", j.state.Seq, len(recs))
+	}
+}
+
+// durableStore is a MemoryStore that claims to survive restarts, standing
+// in for the SQLite store.
+type durableStore struct {
+	*MemoryStore
+}
+
+func (durableStore) Durable() bool { return true }
+
+// settledAuction creates a Dutch auction on m and wins it, so it settles
+// right away.
+func settledAuction(t *testing.T, m *Manager) *Auction {
+	t.Helper()
+	a, err := m.Create(CreateAuctionParams{
+		Title: "lot", Format: FormatDutch, StartPriceCents: 1000,
+		DurationSeconds: 60, DecrementCents: 100, DecrementIntervalSeconds: 60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.PlaceBid(context.Background(), a.ID, &User{ID: "u1", Handle: "u1"}, 0, "")
+	if err != nil || !res.Accepted {
+		t.Fatalf("bid: %+v %v", res, err)
+	}
+	// The ack goes out just before the room closes the auction.
+	waitResult(t, m, a.ID)
+	return a
+}
+
+// waitResult waits for the auction's room to settle it.
+func waitResult(t *testing.T, m *Manager, id string) *Settlement {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if s, err := m.Result(id); err == nil {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("auction did not settle")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// restart snapshots j and reopens the journal into a fresh manager over
+// store, as after a process restart.
+func restart(t *testing.T, dir string, j *Journal, store AuctionStore, bids BidStore) *Manager {
+	t.Helper()
+	if err := j.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	m := NewManager(store, bids)
+	if err := m.Recover(j); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRecoverKeepsSettledAuctionsWithMemoryStore(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryStore()
+	m := NewManager(store, store)
+	if err := m.Recover(j); err != nil {
+		t.Fatal(err)
+	}
+	a := settledAuction(t, m)
+
+	store = NewMemoryStore()
+	m = restart(t, dir, j, store, store)
+	s, err := m.Result(a.ID)
+	if err != nil {
+		t.Fatalf("result after restart: %v", err)
+	}
+	if s.WinnerUserID != "u1" || s.HammerPriceCents != 1000 {
+		t.Errorf("got settlement %+v", s)
+	}
+	if bids, _ := store.ListBids(a.ID); len(bids) != 1 {
+		t.Errorf("got %d bids after restart, want 1", len(bids))
+	}
+}
+
+func TestRecoverPrunesSettledAuctionsWithDurableStore(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := durableStore{NewMemoryStore()}
+	m := NewManager(store, store)
+	if err := m.Recover(j); err != nil {
+		t.Fatal(err)
+	}
+	a := settledAuction(t, m)
+
+	// The durable store still holds it; the journal no longer does.
+	m = restart(t, dir, j, store, store)
+	if _, err := m.Result(a.ID); err != nil {
+		t.Fatalf("result after restart: %v", err)
+	}
+	empty := NewMemoryStore()
+	if _, err := restart(t, dir, m.journal, empty, empty).Result(a.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v from the journal alone, want ErrNotFound", err)
+	}
+}
+
+func TestRecoverSettlesAuctionClosedBeforeCrash(t *testing.T) {
+	dir := t.TempDir()
+	lines := journalLines(t,
+		created(1, "a", FormatEnglish),
+		bid(2, "a", "u1", 1500),
+		Record{Seq: 3, Type: RecStatus, AuctionID: "a", Status: StatusClosing},
+		Record{Seq: 4, Type: RecStatus, AuctionID: "a", Status: StatusClosed},
+	)
+	if err := os.WriteFile(filepath.Join(dir, journalFile), []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	store := NewMemoryStore()
+	m := NewManager(store, store)
+	if err := m.Recover(j); err != nil {
+		t.Fatal(err)
+	}
+	if s := waitResult(t, m, "a"); s.WinnerUserID != "u1" || s.HammerPriceCents != 1500 {
+		t.Errorf("got settlement %+v", s)
+	}
+}
+
+func TestResumeRoomsSettlesAuctionClosedBeforeCrash(t *testing.T) {
+	store := NewMemoryStore()
+	a := &Auction{ID: "a", Format: FormatEnglish, Status: StatusClosed, StartPriceCents: 1000}
+	if err := store.PutAuction(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendBid("a", BidView{Seq: 1, UserID: "u1", Handle: "u1", AmountCts: 1500, Accepted: true}); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(store, store)
+	if err := m.ResumeRooms(); err != nil {
+		t.Fatal(err)
+	}
+	if s := waitResult(t, m, "a"); s.WinnerUserID != "u1" || s.HammerPriceCents != 1500 {
+		t.Errorf("got settlement %+v", s)
+	}
+}
@@ -0,0 +1,15 @@
+package auction
+
+import "math"
+
+// Money is carried as int64 cents everywhere in the engine. These helpers
+// convert at the edges where decimal currency units come in or go out.
+
+// ToCents rounds a currency amount to the nearest cent.
+func ToCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
+
+func FromCents(v int64) float64 {
+	return float64(v) / 100
+}
@@ -0,0 +1,91 @@
+package auction
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// RoomPatch is the change to RoomState since the previous patch. Clients
+// apply patches whose Version is one past theirs and ask for a snapshot
+// when they see a gap.
+type RoomPatch struct {
+	Version int64 `json:"version"`
+	// Set holds the RoomState fields that changed, by JSON name, with
+	// their RoomState types so every encoding sends them as it would in a
+	// snapshot; null removes a field that is no longer present.
+	Set map[string]any `json:"set,omitempty"`
+	// Bids are appended to the bid history, oldest first.
+	Bids []BidView `json:"bids,omitempty"`
+}
+
+// sentState is what the room last sent, so ticks only carry differences.
+// Fields are kept JSON-encoded for comparison.
+type sentState struct {
+	fields map[string][]byte
+	bidSeq int64
+}
+
+// diff returns the patch from the last sent state to state and remembers
+// state as sent. ok is false when nothing changed.
+func (s *sentState) diff(state RoomState) (p RoomPatch, ok bool) {
+	var bids []BidView
+	for _, b := range state.BidHistory {
+		if b.Seq > s.bidSeq {
+			bids = append(bids, b)
+		}
+	}
+	set := make(map[string]any)
+	fields := make(map[string][]byte)
+	for k, v := range stateFields(state) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("marshal room state %s field %s: %v", state.AuctionID, k, err)
+			return p, false
+		}
+		fields[k] = data
+		if old, ok := s.fields[k]; !ok || !bytes.Equal(old, data) {
+			set[k] = v
+		}
+	}
+	for k := range s.fields {
+		if _, ok := fields[k]; !ok {
+			set[k] = nil
+		}
+	}
+	s.fields = fields
+	if len(bids) > 0 {
+		s.bidSeq = bids[len(bids)-1].Seq
+	}
+	if len(set) == 0 && len(bids) == 0 {
+		return p, false
+	}
+	if len(set) > 0 {
+		p.Set = set
+	}
+	p.Bids = bids
+	return p, true
+}
+
+// stateFields returns the RoomState fields a snapshot would carry, by JSON
+// name, leaving out bidHistory and version, which patches carry themselves,
+// and omitempty fields that are empty.
+func stateFields(state RoomState) map[string]any {
+	v := reflect.ValueOf(state)
+	t := v.Type()
+	fields := make(map[string]any, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "bidHistory" || name == "version" {
+			continue
+		}
+		f := v.Field(i)
+		if opts == "omitempty" && f.IsZero() {
+			continue
+		}
+		fields[name] = f.Interface()
+	}
+	return fields
+}
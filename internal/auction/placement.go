@@ -0,0 +1,71 @@
+package auction
+
+import "log"
+
+// Placement assigns rooms to nodes when several servers share the stores.
+// Nodes may briefly disagree about an owner while membership changes; the
+// stores stay the source of truth, and a room that moves is reloaded from
+// them as after a restart.
+type Placement interface {
+	// Owner returns the base URL of the node that runs the auction's room
+	// and whether that node is this one.
+	Owner(auctionID string) (url string, local bool)
+}
+
+// UsePlacement makes the manager run only the rooms p assigns to this node.
+// Call it before ResumeRooms and serving traffic.
+func (m *Manager) UsePlacement(p Placement) {
+	m.placement = p
+}
+
+// Owner reports which node runs the auction's room. Without a Placement
+// every room is local.
+func (m *Manager) Owner(id string) (string, bool) {
+	if m.placement == nil {
+		return "", true
+	}
+	return m.placement.Owner(id)
+}
+
+// Rebalance stops the rooms this node no longer owns and starts the rooms of
+// unfinished auctions it now does, including ones created on other nodes.
+func (m *Manager) Rebalance() error {
+	var moved []*Room
+	m.mu.Lock()
+	for id, r := range m.rooms {
+		if _, local := m.Owner(id); !local {
+			delete(m.rooms, id)
+			moved = append(moved, r)
+		}
+	}
+	m.mu.Unlock()
+	for _, r := range moved {
+		r.stop()
+	}
+	if len(moved) > 0 {
+		log.Printf("placement: handed off %d rooms", len(moved))
+	}
+	return m.ResumeRooms()
+}
+
+func (r *Room) stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+// shutdown ends the room after a handoff. Subscriber streams close, so
+// clients reconnect and reach the new owner, and queued requests are
+// refused with room_moved.
+func (r *Room) shutdown() {
+	for id, ch := range r.subscribers {
+		close(ch)
+		delete(r.subscribers, id)
+	}
+	for {
+		select {
+		case ev := <-r.input:
+			r.nack(ev, "room_moved")
+		default:
+			return
+		}
+	}
+}
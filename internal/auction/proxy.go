@@ -0,0 +1,139 @@
+package auction
+
+import (
+	"sort"
+	"time"
+)
+
+// maxBid is a hidden ceiling registered by a user. The engine bids on the
+// user's behalf in MinIncrementCents steps up to maxCts. Ceilings never leave
+// the room goroutine: only the resulting bids show up in state and history.
+type maxBid struct {
+	user   *User
+	maxCts int64
+	seq    int // registration order; earlier ceilings win ties
+	// reply is where the owner registered the ceiling from; it hears if the
+	// engine has to drop it. Ceilings restored from the journal have none.
+	reply chan<- Outbound
+}
+
+func (r *Room) processMaxBid(ev Event) {
+	now := time.Now().UTC()
+	user := ev.User
+	amount := ev.AmountCts
+	reason := ""
+
+	r.advance(now)
+
+	leading := r.leader != nil && user != nil && r.leader.ID == user.ID
+	if user == nil {
+		reason = "unauthorized"
+	} else if r.auction.Status != StatusOpen {
+		reason = statusRejection(r.auction.Status)
+	} else if r.auction.Format != FormatEnglish {
+		reason = "unsupported_for_format"
+	} else if leading && amount < r.currentPriceCts {
+		reason = "below_current_price"
+	} else if !leading && amount < r.currentPriceCts+r.auction.MinIncrementCents {
+		reason = "below_min_increment"
+	} else {
+		// The whole ceiling must be payable; holds follow the actual bids.
+		reason = r.cover(user, amount)
+	}
+	if reason != "" {
+		// The ceiling itself is never shown to the room.
+		r.nack(ev, reason)
+		return
+	}
+
+	r.maxBidSeq++
+	r.maxBids[user.ID] = &maxBid{user: user, maxCts: amount, seq: r.maxBidSeq, reply: ev.Reply}
+	r.record(Record{Type: RecMaxBidSet, MaxBid: &MaxBidRecord{User: user, MaxCts: amount, Seq: r.maxBidSeq}})
+	r.ack(ev, map[string]any{"maxCents": amount})
+	r.resolveProxies(now)
+}
+
+// resolveProxies lets the strongest maximum bid respond to the current price.
+// The highest ceiling wins (earliest registration on ties) and pays one
+// increment over the runner-up, capped at its own ceiling. A ceiling must
+// beat the standing bid by at least one increment to take the lead.
+func (r *Room) resolveProxies(now time.Time) {
+	if len(r.maxBids) == 0 {
+		return
+	}
+	ranked := make([]*maxBid, 0, len(r.maxBids))
+	for _, p := range r.maxBids {
+		ranked = append(ranked, p)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].maxCts != ranked[j].maxCts {
+			return ranked[i].maxCts > ranked[j].maxCts
+		}
+		return ranked[i].seq < ranked[j].seq
+	})
+	top := ranked[0]
+	var runnerUp *maxBid
+	if len(ranked) > 1 {
+		runnerUp = ranked[1]
+	}
+	inc := r.auction.MinIncrementCents
+
+	if r.leader != nil && r.leader.ID == top.user.ID {
+		// The leader's ceiling only moves the price when another ceiling pushes it.
+		if runnerUp == nil || runnerUp.maxCts <= r.currentPriceCts {
+			return
+		}
+		price := min(top.maxCts, runnerUp.maxCts+inc)
+		if price > r.currentPriceCts {
+			r.acceptProxy(top, price, now)
+		}
+		return
+	}
+
+	price := r.currentPriceCts + inc
+	if top.maxCts < price {
+		return
+	}
+	if runnerUp != nil {
+		price = max(price, runnerUp.maxCts+inc)
+	}
+	r.acceptProxy(top, min(price, top.maxCts), now)
+}
+
+// acceptProxy bids for a ceiling's owner. If their funds no longer cover the
+// price the ceiling is dropped and the next one gets its turn.
+func (r *Room) acceptProxy(p *maxBid, price int64, now time.Time) {
+	if reason := r.hold(p.user, price); reason != "" {
+		r.dropMaxBid(p, reason)
+		r.appendBid(BidView{
+			UserID:    p.user.ID,
+			Handle:    p.user.Handle,
+			AmountCts: price,
+			Reason:    reason,
+			Auto:      true,
+			CreatedAt: now,
+		})
+		r.resolveProxies(now)
+		return
+	}
+	r.acceptBid(p.user, price, now, true, "")
+}
+
+// dropMaxBid removes a ceiling the engine can no longer bid for. The removal
+// is journaled so recovery does not bring the ceiling back, and the owner
+// gets a max_bid_cleared notice on the connection that registered it.
+func (r *Room) dropMaxBid(p *maxBid, reason string) {
+	delete(r.maxBids, p.user.ID)
+	r.record(Record{Type: RecMaxBidCleared, MaxBid: &MaxBidRecord{User: p.user, MaxCts: p.maxCts, Seq: p.seq}})
+	if p.reply == nil {
+		return
+	}
+	notice := Outbound{Type: "max_bid_cleared", RoomID: r.auction.ID, Payload: map[string]any{
+		"maxCents": p.maxCts,
+		"reason":   reason,
+	}}
+	select {
+	case p.reply <- notice:
+	default:
+	}
+}
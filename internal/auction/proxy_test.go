@@ -0,0 +1,142 @@
+package auction
+
+import (
+	"testing"
+)
+
+func TestResolveProxies(t *testing.T) {
+	type step struct {
+		user  string
+		max   bool // set_max_bid rather than place_bid
+		cents int64
+	}
+	tests := []struct {
+		name       string
+		steps      []step
+		wantLeader string
+		wantCts    int64
+	}{
+		{
+			name:       "lone ceiling opens one increment up",
+			steps:      []step{{"u1", true, 2000}},
+			wantLeader: "u1", wantCts: 1100,
+		},
+		{
+			name:       "highest ceiling pays one increment over the runner-up",
+			steps:      []step{{"u1", true, 2000}, {"u2", true, 3000}},
+			wantLeader: "u2", wantCts: 2100,
+		},
+		{
+			name:       "runner-up ceiling pushes the leader's",
+			steps:      []step{{"u1", true, 3000}, {"u2", true, 2000}},
+			wantLeader: "u1", wantCts: 2100,
+		},
+		{
+			name:       "price is capped at the winning ceiling",
+			steps:      []step{{"u1", true, 2000}, {"u2", true, 2050}},
+			wantLeader: "u2", wantCts: 2050,
+		},
+		{
+			name:       "earlier ceiling wins a tie",
+			steps:      []step{{"u1", true, 3000}, {"u2", true, 3000}},
+			wantLeader: "u1", wantCts: 3000,
+		},
+		{
+			name:       "ceiling answers a manual bid",
+			steps:      []step{{"u1", true, 3000}, {"u2", false, 1500}},
+			wantLeader: "u1", wantCts: 1600,
+		},
+		{
+			name:       "manual bid over the ceiling leads",
+			steps:      []step{{"u1", true, 2000}, {"u2", false, 2500}},
+			wantLeader: "u2", wantCts: 2500,
+		},
+		{
+			name:       "ceiling less than an increment above a bid does not answer",
+			steps:      []step{{"u1", true, 2000}, {"u2", false, 1950}},
+			wantLeader: "u2", wantCts: 1950,
+		},
+		{
+			name:       "raising the leader's own ceiling keeps the price",
+			steps:      []step{{"u1", true, 2000}, {"u1", true, 5000}},
+			wantLeader: "u1", wantCts: 1100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRoom(t, Auction{Format: FormatEnglish, StartPriceCents: 1000, MinIncrementCents: 100})
+			for _, st := range tt.steps {
+				if st.max {
+					r.handle(Event{Type: "set_max_bid", User: &User{ID: st.user, Handle: st.user}, AmountCts: st.cents})
+				} else {
+					bidAs(r, st.user, st.cents)
+				}
+			}
+			if r.leader == nil || r.leader.ID != tt.wantLeader || r.currentPriceCts != tt.wantCts {
+				t.Errorf("got leader %v at %d, want %s at %d", r.leader, r.currentPriceCts, tt.wantLeader, tt.wantCts)
+			}
+		})
+	}
+}
+
+// limitFunds lets each user hold up to a fixed amount. CanCover always
+// passes, as if the money was spent elsewhere after the ceiling was set.
+type limitFunds map[string]int64
+
+func (f limitFunds) CanCover(userID, auctionID string, cents int64) error { return nil }
+
+func (f limitFunds) Hold(userID, auctionID string, cents int64) error {
+	if limit, ok := f[userID]; ok && cents > limit {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+func (f limitFunds) Release(userID, auctionID string) error { return nil }
+
+func (f limitFunds) Capture(userID, auctionID string, cents int64) error { return nil }
+
+func TestDroppedMaxBidIsJournaledAndNoticed(t *testing.T) {
+	dir := t.TempDir()
+	j, err := OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testRoom(t, Auction{Format: FormatEnglish, StartPriceCents: 1000, MinIncrementCents: 100})
+	r.mgr.journal = j
+	r.mgr.funds = limitFunds{"u1": 1000}
+	r.record(Record{Type: RecAuctionCreated, Auction: r.auction})
+
+	reply := make(chan Outbound, 4)
+	r.handle(Event{Type: "set_max_bid", User: &User{ID: "u1", Handle: "u1"}, AmountCts: 3000, Reply: reply})
+	if ack := <-reply; ack.Type != "ack" {
+		t.Fatalf("set_max_bid: got %s %v", ack.Type, ack.Payload)
+	}
+	bidAs(r, "u2", 1500)
+
+	if len(r.maxBids) != 0 {
+		t.Errorf("ceiling still registered")
+	}
+	select {
+	case notice := <-reply:
+		p := notice.Payload.(map[string]any)
+		if notice.Type != "max_bid_cleared" || p["maxCents"] != int64(3000) || p["reason"] != "insufficient_funds" {
+			t.Errorf("got notice %s %v", notice.Type, p)
+		}
+	default:
+		t.Error("owner was not told")
+	}
+	if r.leader == nil || r.leader.ID != "u2" || r.currentPriceCts != 1500 {
+		t.Errorf("got leader %v at %d", r.leader, r.currentPriceCts)
+	}
+
+	j.Close()
+	j, err = OpenJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if img := j.state.Auctions["a"]; img == nil || len(img.MaxBids) != 0 {
+		t.Errorf("ceiling comes back after recovery: %+v", img)
+	}
+}
@@ -0,0 +1,34 @@
+package auction
+
+// replaySize bounds how many broadcasts a room keeps for resuming clients.
+// At one room_state a second plus bids this covers several minutes offline.
+const replaySize = 1024
+
+// replayBuffer is a ring of the room's most recent broadcasts, oldest first.
+type replayBuffer struct {
+	msgs  []Outbound
+	start int
+}
+
+func (b *replayBuffer) add(msg Outbound) {
+	if len(b.msgs) < replaySize {
+		b.msgs = append(b.msgs, msg)
+		return
+	}
+	b.msgs[b.start] = msg
+	b.start = (b.start + 1) % replaySize
+}
+
+// since returns every broadcast after lastSeq, or false when the buffer no
+// longer reaches back that far. Callers check lastSeq is from this epoch.
+func (b *replayBuffer) since(lastSeq, seq int64) ([]Outbound, bool) {
+	if lastSeq < 0 || lastSeq > seq || seq-lastSeq > int64(len(b.msgs)) {
+		return nil, false
+	}
+	n := int(seq - lastSeq)
+	out := make([]Outbound, 0, n)
+	for i := len(b.msgs) - n; i < len(b.msgs); i++ {
+		out = append(out, b.msgs[(b.start+i)%len(b.msgs)])
+	}
+	return out, true
+}
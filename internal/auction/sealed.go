@@ -0,0 +1,95 @@
+package auction
+
+import (
+	"sort"
+	"time"
+)
+
+// processSealedBid records a hidden bid. Each bidder holds one sealed bid;
+// a later bid replaces the earlier one. The start price is the minimum bid.
+func (r *Room) processSealedBid(ev Event, now time.Time) {
+	user := ev.User
+	amount := ev.AmountCts
+	reason := ""
+	if user == nil {
+		reason = "unauthorized"
+	} else if r.auction.Status != StatusOpen {
+		reason = statusRejection(r.auction.Status)
+	} else if amount < r.auction.StartPriceCents {
+		reason = "below_min_bid"
+	} else {
+		// Every sealed bid may win, so each one is held until the close.
+		reason = r.hold(user, amount)
+	}
+
+	entry := r.appendBid(BidView{
+		UserID:         userID(user),
+		Handle:         userHandle(user),
+		AmountCts:      amount,
+		Accepted:       reason == "",
+		Reason:         reason,
+		CreatedAt:      now,
+		IdempotencyKey: ev.IdempotencyKey,
+	})
+
+	if reason != "" {
+		r.nack(ev, reason)
+		return
+	}
+
+	r.sealedBids[user.ID] = entry
+	r.ack(ev, map[string]any{"amountCents": amount})
+	// Only the number of bidders is public until the auction closes.
+	r.broadcastCritical(Outbound{
+		Type:   "bid_sealed",
+		RoomID: r.auction.ID,
+		Payload: map[string]any{
+			"sealedBids": len(r.sealedBids),
+		},
+	})
+	r.broadcastState()
+}
+
+// revealSealed ranks the sealed bids and sets the leader and price to the
+// winner and clearing price of the auction's format.
+func (r *Room) revealSealed() {
+	ranking := make([]BidView, 0, len(r.sealedBids))
+	for _, b := range r.sealedBids {
+		ranking = append(ranking, b)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].AmountCts != ranking[j].AmountCts {
+			return ranking[i].AmountCts > ranking[j].AmountCts
+		}
+		// The earlier bid wins a tie.
+		return ranking[i].Seq < ranking[j].Seq
+	})
+	r.ranking = ranking
+	if len(ranking) == 0 {
+		return
+	}
+
+	top := ranking[0]
+	price := top.AmountCts
+	if r.auction.Format == FormatSealedSecondPrice {
+		// The winner pays the runner-up's bid, floored at the start price and
+		// at the reserve when the winning bid meets it.
+		price = r.auction.StartPriceCents
+		if len(ranking) > 1 {
+			price = max(price, ranking[1].AmountCts)
+		}
+		if top.AmountCts >= r.auction.ReservePriceCents {
+			price = max(price, r.auction.ReservePriceCents)
+		}
+	}
+	r.leader = &User{ID: top.UserID, Handle: top.Handle}
+	r.currentPriceCts = price
+}
+
+// sealedHidden reports whether bids must stay out of the public state.
+func (r *Room) sealedHidden() bool {
+	if !r.auction.Format.Sealed() {
+		return false
+	}
+	return r.auction.Status != StatusClosed && r.auction.Status != StatusSettled
+}
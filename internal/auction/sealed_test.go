@@ -0,0 +1,126 @@
+package auction
+
+import (
+	"testing"
+	"time"
+)
+
+// testRoom returns a room for a copy of a that is not running, so tests
+// can drive it with handle and close from their own goroutine.
+func testRoom(t *testing.T, a Auction) *Room {
+	t.Helper()
+	store := NewMemoryStore()
+	if a.ID == "" {
+		a.ID = "a"
+	}
+	a.Status = StatusOpen
+	a.EndsAt = time.Now().Add(time.Hour)
+	if err := store.PutAuction(&a); err != nil {
+		t.Fatal(err)
+	}
+	return newRoom(NewManager(store, store), &a)
+}
+
+// bidAs places a bid on r as user id.
+func bidAs(r *Room, id string, cents int64) {
+	r.handle(Event{Type: "place_bid", User: &User{ID: id, Handle: id}, AmountCts: cents})
+}
+
+func TestSealedRankingKeepsBidSeqs(t *testing.T) {
+	r := testRoom(t, Auction{Format: FormatSealedFirstPrice, StartPriceCents: 100})
+	bidAs(r, "u1", 500)
+	bidAs(r, "u2", 700)
+	bidAs(r, "u1", 600)
+	r.close(time.Now())
+	s, err := r.mgr.Result("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"u2": 2, "u1": 3}
+	if len(s.Ranking) != len(want) {
+		t.Fatalf("got %d ranked bids, want %d", len(s.Ranking), len(want))
+	}
+	for _, b := range s.Ranking {
+		if b.Seq != want[b.UserID] {
+			t.Errorf("%s: got seq %d, want %d", b.UserID, b.Seq, want[b.UserID])
+		}
+	}
+}
+
+func TestRevealSealed(t *testing.T) {
+	type entry struct {
+		user  string
+		cents int64
+	}
+	tests := []struct {
+		name        string
+		format      Format
+		reserve     int64
+		bids        []entry
+		wantWinner  string
+		wantHammer  int64
+		wantHighBid int64
+	}{
+		{
+			name:       "first price pays the winning bid",
+			format:     FormatSealedFirstPrice,
+			bids:       []entry{{"u1", 500}, {"u2", 800}},
+			wantWinner: "u2", wantHammer: 800, wantHighBid: 800,
+		},
+		{
+			name:       "second price pays the runner-up",
+			format:     FormatSealedSecondPrice,
+			bids:       []entry{{"u1", 500}, {"u2", 800}},
+			wantWinner: "u2", wantHammer: 500, wantHighBid: 800,
+		},
+		{
+			name:       "lone second-price bid pays the start price",
+			format:     FormatSealedSecondPrice,
+			bids:       []entry{{"u1", 800}},
+			wantWinner: "u1", wantHammer: 100, wantHighBid: 800,
+		},
+		{
+			name:       "second price is floored at a reserve the winner meets",
+			format:     FormatSealedSecondPrice,
+			reserve:    700,
+			bids:       []entry{{"u1", 500}, {"u2", 800}},
+			wantWinner: "u2", wantHammer: 700, wantHighBid: 800,
+		},
+		{
+			name:       "winner under the reserve does not sell",
+			format:     FormatSealedSecondPrice,
+			reserve:    900,
+			bids:       []entry{{"u1", 500}, {"u2", 800}},
+			wantWinner: "", wantHammer: 0, wantHighBid: 800,
+		},
+		{
+			name:       "earlier bid wins a tie",
+			format:     FormatSealedSecondPrice,
+			bids:       []entry{{"u1", 800}, {"u2", 800}},
+			wantWinner: "u1", wantHammer: 800, wantHighBid: 800,
+		},
+		{
+			name:       "a later bid replaces the bidder's earlier one",
+			format:     FormatSealedSecondPrice,
+			bids:       []entry{{"u1", 900}, {"u2", 600}, {"u1", 400}},
+			wantWinner: "u2", wantHammer: 400, wantHighBid: 600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRoom(t, Auction{Format: tt.format, StartPriceCents: 100, ReservePriceCents: tt.reserve})
+			for _, b := range tt.bids {
+				bidAs(r, b.user, b.cents)
+			}
+			r.close(time.Now())
+			s, err := r.mgr.Result("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.WinnerUserID != tt.wantWinner || s.HammerPriceCents != tt.wantHammer || s.HighBidCents != tt.wantHighBid {
+				t.Errorf("got %q at %d (high %d), want %q at %d (high %d)",
+					s.WinnerUserID, s.HammerPriceCents, s.HighBidCents, tt.wantWinner, tt.wantHammer, tt.wantHighBid)
+			}
+		})
+	}
+}
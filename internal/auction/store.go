@@ -0,0 +1,178 @@
+package auction
+
+import (
+	"sort"
+	"sync"
+)
+
+// AuctionStore persists auctions and their settlements. Implementations
+// return copies; callers may keep or modify what they get back.
+type AuctionStore interface {
+	// PutAuction inserts or replaces an auction.
+	PutAuction(a *Auction) error
+	// GetAuction returns ErrNotFound for unknown ids.
+	GetAuction(id string) (*Auction, error)
+	ListAuctions() ([]*Auction, error)
+	// ListUnfinishedAuctions returns the auctions whose rooms still have
+	// work: those not settled or cancelled, other than closed ones whose
+	// settlement is already recorded.
+	ListUnfinishedAuctions() ([]*Auction, error)
+	PutSettlement(s *Settlement) error
+	// GetSettlement returns ErrNotSettled when none has been recorded.
+	GetSettlement(auctionID string) (*Settlement, error)
+}
+
+// Durable is implemented by stores that keep their contents across
+// restarts. The journal only forgets a finished auction once durable stores
+// hold all of it; otherwise it remains the only copy.
+type Durable interface {
+	Durable() bool
+}
+
+func durable(s any) bool {
+	d, ok := s.(Durable)
+	return ok && d.Durable()
+}
+
+// BidStore keeps the full bid history of every auction.
+type BidStore interface {
+	// AppendBid stores a bid; a bid whose Seq is already stored is ignored.
+	AppendBid(auctionID string, b BidView) error
+	// ListBids returns an auction's bids in Seq order.
+	ListBids(auctionID string) ([]BidView, error)
+	// QueryBids returns up to q.Limit of an auction's bids matching q, in
+	// Seq order.
+	QueryBids(auctionID string, q BidQuery) ([]BidView, error)
+}
+
+// BidQuery selects a page of bid history. Zero fields do not filter.
+type BidQuery struct {
+	// AfterSeq skips bids up to and including this Seq; pass the last Seq
+	// of the previous page to get the next one.
+	AfterSeq int64
+	UserID   string
+	Accepted *bool
+	// IdempotencyKey finds the bid placed with a key; pair it with UserID.
+	IdempotencyKey string
+	Limit          int
+}
+
+func (q BidQuery) match(b BidView) bool {
+	return b.Seq > q.AfterSeq &&
+		(q.UserID == "" || b.UserID == q.UserID) &&
+		(q.Accepted == nil || b.Accepted == *q.Accepted) &&
+		(q.IdempotencyKey == "" || b.IdempotencyKey == q.IdempotencyKey)
+}
+
+// MemoryStore keeps everything in maps. It implements both AuctionStore and
+// BidStore and loses its contents on restart unless a journal is used.
+type MemoryStore struct {
+	mu          sync.RWMutex
+	auctions    map[string]*Auction
+	settlements map[string]*Settlement
+	bids        map[string][]BidView
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		auctions:    make(map[string]*Auction),
+		settlements: make(map[string]*Settlement),
+		bids:        make(map[string][]BidView),
+	}
+}
+
+func (s *MemoryStore) PutAuction(a *Auction) error {
+	cp := *a
+	s.mu.Lock()
+	s.auctions[a.ID] = &cp
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetAuction(id string) (*Auction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.auctions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (s *MemoryStore) ListAuctions() ([]*Auction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Auction, 0, len(s.auctions))
+	for _, a := range s.auctions {
+		cp := *a
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *MemoryStore) ListUnfinishedAuctions() ([]*Auction, error) {
+	all, _ := s.ListAuctions()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := all[:0]
+	for _, a := range all {
+		_, settled := s.settlements[a.ID]
+		if !a.Status.Final() || (a.Status == StatusClosed && !settled) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) PutSettlement(st *Settlement) error {
+	cp := *st
+	s.mu.Lock()
+	s.settlements[st.AuctionID] = &cp
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) GetSettlement(auctionID string) (*Settlement, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st, ok := s.settlements[auctionID]
+	if !ok {
+		return nil, ErrNotSettled
+	}
+	cp := *st
+	return &cp, nil
+}
+
+func (s *MemoryStore) AppendBid(auctionID string, b BidView) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bids := s.bids[auctionID]
+	if n := len(bids); n > 0 && bids[n-1].Seq >= b.Seq {
+		return nil
+	}
+	s.bids[auctionID] = append(bids, b)
+	return nil
+}
+
+func (s *MemoryStore) ListBids(auctionID string) ([]BidView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]BidView(nil), s.bids[auctionID]...), nil
+}
+
+func (s *MemoryStore) QueryBids(auctionID string, q BidQuery) ([]BidView, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []BidView
+	for _, b := range s.bids[auctionID] {
+		if len(out) == q.Limit {
+			break
+		}
+		if q.match(b) {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
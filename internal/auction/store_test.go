@@ -0,0 +1,48 @@
+package auction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreListUnfinishedAuctions(t *testing.T) {
+	tests := []struct {
+		id      string
+		status  Status
+		settled bool
+		want    bool
+	}{
+		{"scheduled", StatusScheduled, false, true},
+		{"open", StatusOpen, false, true},
+		{"closing", StatusClosing, false, true},
+		{"closed before settling", StatusClosed, false, true},
+		{"closed and settled", StatusClosed, true, false},
+		{"settled", StatusSettled, true, false},
+		{"cancelled", StatusCancelled, false, false},
+	}
+	s := NewMemoryStore()
+	now := time.Now()
+	for i, tt := range tests {
+		if err := s.PutAuction(&Auction{ID: tt.id, Status: tt.status, CreatedAt: now.Add(time.Duration(i))}); err != nil {
+			t.Fatal(err)
+		}
+		if tt.settled {
+			if err := s.PutSettlement(&Settlement{AuctionID: tt.id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	list, err := s.ListUnfinishedAuctions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, a := range list {
+		got[a.ID] = true
+	}
+	for _, tt := range tests {
+		if got[tt.id] != tt.want {
+			t.Errorf("%s: listed %v, want %v", tt.id, got[tt.id], tt.want)
+		}
+	}
+}
@@ -2,34 +2,117 @@ package auction
 
 import "time"
 
+// Status is the lifecycle stage of an auction. Transitions are driven by the
+// room goroutine: scheduled -> open -> closing -> closed -> settled, with
+// cancelled reachable from any stage before closed.
+type Status string
+
+const (
+	StatusScheduled Status = "scheduled"
+	StatusOpen      Status = "open"
+	StatusClosing   Status = "closing"
+	StatusClosed    Status = "closed"
+	StatusSettled   Status = "settled"
+	StatusCancelled Status = "cancelled"
+)
+
+// Final reports whether no further transitions can happen.
+func (s Status) Final() bool {
+	return s == StatusClosed || s == StatusSettled || s == StatusCancelled
+}
+
+// Format selects the auction rules applied by the room.
+type Format string
+
+const (
+	// FormatEnglish is an open ascending auction; the default.
+	FormatEnglish Format = "english"
+	// FormatSealedFirstPrice hides bids until close; the highest bid pays its own amount.
+	FormatSealedFirstPrice Format = "sealed_first_price"
+	// FormatSealedSecondPrice (Vickrey) hides bids until close; the highest bid
+	// pays the second-highest amount.
+	FormatSealedSecondPrice Format = "sealed_second_price"
+	// FormatDutch is a descending-price auction; the first bidder to accept
+	// the current price wins immediately.
+	FormatDutch Format = "dutch"
+)
+
+func (f Format) Valid() bool {
+	switch f {
+	case FormatEnglish, FormatSealedFirstPrice, FormatSealedSecondPrice, FormatDutch:
+		return true
+	}
+	return false
+}
+
+func (f Format) Sealed() bool {
+	return f == FormatSealedFirstPrice || f == FormatSealedSecondPrice
+}
+
 type Auction struct {
-	ID               string    `json:"id"`
-	Title            string    `json:"title"`
-	StartPriceCents  int64     `json:"startPriceCents"`
-	MinIncrementCents int64    `json:"minIncrementCents"`
-	ReservePriceCents int64    `json:"reservePriceCents"`
-	EndsAt           time.Time `json:"endsAt"`
-	SoftCloseSeconds int64     `json:"softCloseSeconds"`
-	CreatedAt        time.Time `json:"createdAt"`
+	ID                string    `json:"id"`
+	Title             string    `json:"title"`
+	Format            Format    `json:"format"`
+	Status            Status    `json:"status"`
+	StartPriceCents   int64     `json:"startPriceCents"`
+	MinIncrementCents int64     `json:"minIncrementCents"`
+	ReservePriceCents int64     `json:"reservePriceCents"`
+	StartsAt          time.Time `json:"startsAt"`
+	EndsAt            time.Time `json:"endsAt"`
+	SoftCloseSeconds  int64     `json:"softCloseSeconds"`
+	// Dutch auctions only: the price falls by DecrementCents every
+	// DecrementIntervalSeconds until it reaches FloorPriceCents.
+	DecrementCents           int64     `json:"decrementCents,omitempty"`
+	DecrementIntervalSeconds int64     `json:"decrementIntervalSeconds,omitempty"`
+	FloorPriceCents          int64     `json:"floorPriceCents,omitempty"`
+	CreatedAt                time.Time `json:"createdAt"`
 }
 
+// Settlement is the recorded outcome of a closed auction. Lots without a
+// winner (no bids or reserve not met) have an empty winner and zero hammer price.
+type Settlement struct {
+	AuctionID         string    `json:"auctionId"`
+	WinnerUserID      string    `json:"winnerUserId,omitempty"`
+	WinnerHandle      string    `json:"winnerHandle,omitempty"`
+	HammerPriceCents  int64     `json:"hammerPriceCents"`
+	HighBidCents      int64     `json:"highBidCents"`
+	ReservePriceCents int64     `json:"reservePriceCents"`
+	ReserveMet        bool      `json:"reserveMet"`
+	BidCount          int       `json:"bidCount"`
+	ClosedAt          time.Time `json:"closedAt"`
+	// Ranking reveals every bidder's final sealed bid, best first. Empty for
+	// open formats, where the bid history is already public.
+	Ranking []BidView `json:"ranking,omitempty"`
+}
+
+// User is a bidder as the engine sees it; the account behind it lives in
+// the users package.
 type User struct {
-	ID     string `json:"id"`
-	Handle string `json:"handle"`
+	ID          string `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName,omitempty"`
+	Verified    bool   `json:"verified,omitempty"`
 }
 
 type ParticipantView struct {
-	UserID string `json:"userId"`
-	Handle string `json:"handle"`
+	UserID      string `json:"userId"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"displayName,omitempty"`
+	Verified    bool   `json:"verified,omitempty"`
 }
 
 type CreateAuctionParams struct {
-	Title            string
-	StartPriceCents  int64
+	Title             string
+	Format            Format // defaults to FormatEnglish
+	StartPriceCents   int64
 	MinIncrementCents int64
-	DurationSeconds  int64
-	SoftCloseSeconds int64
+	// StartDelaySeconds keeps the auction scheduled for this long before it opens.
+	StartDelaySeconds int64
+	DurationSeconds   int64
+	SoftCloseSeconds  int64
 	ReservePriceCents int64
+	// Dutch auctions only.
+	DecrementCents           int64
+	DecrementIntervalSeconds int64
+	FloorPriceCents          int64
 }
-
-
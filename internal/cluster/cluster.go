@@ -0,0 +1,310 @@
+// Package cluster spreads auction rooms over several server nodes sharing
+// the same stores. Nodes probe each other, and every room belongs to one live
+// node picked by consistent hashing, so ownership moves when nodes join or
+// leave. Requests that land on the wrong node are proxied to the owner.
+package cluster
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PingPath is where nodes probe each other.
+const PingPath = "/cluster/ping"
+
+const (
+	// maxFailures is how many probes in a row a node may miss before its
+	// rooms move elsewhere.
+	maxFailures = 3
+	// forgetAfter drops nodes learned from peers, rather than configured as
+	// seeds, once they have been down this long.
+	forgetAfter = 5 * time.Minute
+)
+
+// Config describes this node and how it finds the others.
+type Config struct {
+	// URL is this node's base URL as other nodes reach it, e.g.
+	// "http://10.0.0.5:8080". It also names the node on the ring.
+	URL string
+	// Seeds are base URLs of nodes to join through; the rest are learned
+	// from the nodes they know.
+	Seeds []string
+	// Secret authenticates nodes to each other.
+	Secret string
+	// ProbeInterval is how often every known node is probed.
+	ProbeInterval time.Duration
+}
+
+// Cluster is this node's view of the membership. It implements
+// auction.Placement.
+type Cluster struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	members map[string]*member
+	// live lists the nodes on the ring, this one included, sorted.
+	live    []string
+	ring    *ring
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// member is another node. Its fields are guarded by the cluster's mu.
+type member struct {
+	seed     bool
+	up       bool
+	failures int
+	lastSeen time.Time
+}
+
+// MemberInfo describes a node for operators.
+type MemberInfo struct {
+	URL      string    `json:"url"`
+	Self     bool      `json:"self,omitempty"`
+	Up       bool      `json:"up"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// pingMsg is a probe and its answer. Members are the nodes the sender has
+// on its ring.
+type pingMsg struct {
+	URL     string   `json:"url"`
+	Members []string `json:"members"`
+}
+
+func New(cfg Config) (*Cluster, error) {
+	self, err := nodeURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	cfg.URL = self
+	if cfg.Secret == "" {
+		return nil, errors.New("cluster secret required")
+	}
+	if cfg.ProbeInterval <= 0 {
+		return nil, errors.New("probe interval must be positive")
+	}
+	c := &Cluster{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.ProbeInterval},
+		members: make(map[string]*member),
+		live:    []string{self},
+		ring:    newRing([]string{self}),
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	for _, s := range cfg.Seeds {
+		u, err := nodeURL(s)
+		if err != nil {
+			return nil, err
+		}
+		if u != self {
+			c.members[u] = &member{seed: true}
+		}
+	}
+	return c, nil
+}
+
+// nodeURL checks a node's base URL and drops any trailing slash, so every
+// node puts the same name on the ring.
+func nodeURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid node url %q", s)
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// Owner returns the node that runs the auction's room.
+func (c *Cluster) Owner(auctionID string) (string, bool) {
+	c.mu.Lock()
+	owner := c.ring.owner(auctionID)
+	c.mu.Unlock()
+	return owner, owner == c.cfg.URL
+}
+
+// Run probes every known node each ProbeInterval and calls after once per
+// round, so the caller can hand off rooms whose owner changed and start the
+// rooms of auctions created on other nodes.
+func (c *Cluster) Run(after func()) {
+	ticker := time.NewTicker(c.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.Probe()
+		after()
+	}
+}
+
+// Probe runs one round of probes and updates the ring. Call it once before
+// serving traffic so the node starts with the cluster's view.
+func (c *Cluster) Probe() {
+	c.mu.Lock()
+	urls := make([]string, 0, len(c.members))
+	for u := range c.members {
+		urls = append(urls, u)
+	}
+	c.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.probe(u)
+		}()
+	}
+	wg.Wait()
+	c.rebuild()
+}
+
+func (c *Cluster) probe(u string) {
+	peers, err := c.ping(u)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.members[u]
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.failures++
+		if m.up && m.failures >= maxFailures {
+			m.up = false
+			log.Printf("cluster: node %s is down: %v", u, err)
+		}
+		if !m.seed && !m.up && time.Since(m.lastSeen) > forgetAfter {
+			delete(c.members, u)
+		}
+		return
+	}
+	c.seen(u)
+	for _, p := range peers {
+		c.learn(p)
+	}
+}
+
+func (c *Cluster) ping(u string) ([]string, error) {
+	body, err := json.Marshal(pingMsg{URL: c.cfg.URL, Members: c.liveNodes()})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u+PingPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.cfg.Secret)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ping: %s", resp.Status)
+	}
+	var reply pingMsg
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, err
+	}
+	if reply.URL != u {
+		return nil, fmt.Errorf("node at %s calls itself %s", u, reply.URL)
+	}
+	return reply.Members, nil
+}
+
+// ServePing answers another node's probe and learns the nodes it knows.
+func (c *Cluster) ServePing(w http.ResponseWriter, r *http.Request) {
+	if !c.authorized(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var m pingMsg
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "invalid ping", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	if u, err := nodeURL(m.URL); err == nil && u != c.cfg.URL {
+		c.seen(u)
+	}
+	for _, p := range m.Members {
+		c.learn(p)
+	}
+	reply := pingMsg{URL: c.cfg.URL, Members: slices.Clone(c.live)}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+func (c *Cluster) authorized(r *http.Request) bool {
+	want := "Bearer " + c.cfg.Secret
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) == 1
+}
+
+// seen marks a node up. Callers hold c.mu.
+func (c *Cluster) seen(u string) {
+	m := c.members[u]
+	if m == nil {
+		m = &member{}
+		c.members[u] = m
+	}
+	if !m.up {
+		log.Printf("cluster: node %s is up", u)
+	}
+	m.up, m.failures, m.lastSeen = true, 0, time.Now()
+}
+
+// learn adds a node a peer reported; it joins the ring once a probe of our
+// own reaches it. Callers hold c.mu.
+func (c *Cluster) learn(s string) {
+	u, err := nodeURL(s)
+	if err != nil || u == c.cfg.URL || c.members[u] != nil {
+		return
+	}
+	c.members[u] = &member{lastSeen: time.Now()}
+}
+
+// rebuild puts the nodes that are up on the ring.
+func (c *Cluster) rebuild() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	nodes := []string{c.cfg.URL}
+	for u, m := range c.members {
+		if m.up {
+			nodes = append(nodes, u)
+		}
+	}
+	slices.Sort(nodes)
+	if slices.Equal(nodes, c.live) {
+		return
+	}
+	c.live = nodes
+	c.ring = newRing(nodes)
+	log.Printf("cluster: %d nodes on the ring: %s", len(nodes), strings.Join(nodes, ", "))
+}
+
+func (c *Cluster) liveNodes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.live)
+}
+
+// Members lists this node and every node it knows, sorted by URL.
+func (c *Cluster) Members() []MemberInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := []MemberInfo{{URL: c.cfg.URL, Self: true, Up: true, LastSeen: time.Now().UTC()}}
+	for u, m := range c.members {
+		list = append(list, MemberInfo{URL: u, Up: m.up, LastSeen: m.lastSeen.UTC()})
+	}
+	slices.SortFunc(list, func(a, b MemberInfo) int { return strings.Compare(a.URL, b.URL) })
+	return list
+}
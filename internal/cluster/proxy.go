@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// Proxied requests carry the cluster secret and the client's address, so the
+// owner applies per-address limits to the client rather than to the node
+// that forwarded it.
+const (
+	headerSecret = "X-Rtb-Cluster-Secret"
+	headerClient = "X-Rtb-Client-Addr"
+)
+
+// Forward serves requests for rooms this node owns with next and proxies the
+// rest, WebSocket upgrades and event streams included, to the owner. room
+// names the room a request is for; requests without one are served here.
+func (c *Cluster) Forward(room func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded := c.fromPeer(r)
+		id := room(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		owner, local := c.Owner(id)
+		switch {
+		case local:
+			next.ServeHTTP(w, r)
+		case forwarded:
+			// The forwarding node still thinks the room is ours; rather than
+			// bounce it back, let the client retry once the views agree.
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "room is moving between nodes", http.StatusServiceUnavailable)
+		default:
+			c.proxy(owner).ServeHTTP(w, r)
+		}
+	})
+}
+
+// fromPeer reports whether r was proxied by another node, and if so restores
+// the client's address. The headers are dropped from client requests.
+func (c *Cluster) fromPeer(r *http.Request) bool {
+	secret, client := r.Header.Get(headerSecret), r.Header.Get(headerClient)
+	r.Header.Del(headerSecret)
+	r.Header.Del(headerClient)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(c.cfg.Secret)) != 1 {
+		return false
+	}
+	if client != "" {
+		r.RemoteAddr = client
+	}
+	return true
+}
+
+func (c *Cluster) proxy(owner string) *httputil.ReverseProxy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.proxies[owner]; ok {
+		return p
+	}
+	target, _ := url.Parse(owner)
+	p := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(headerSecret, c.cfg.Secret)
+			pr.Out.Header.Set(headerClient, pr.In.RemoteAddr)
+		},
+		// Event streams must reach the client as they are written.
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			// This node already answered with its own CORS headers.
+			for k := range resp.Header {
+				if strings.HasPrefix(k, "Access-Control-") || k == "Vary" {
+					resp.Header.Del(k)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("cluster: proxy %s to %s: %v", r.URL.Path, owner, err)
+			http.Error(w, "owner node unavailable", http.StatusBadGateway)
+		},
+	}
+	c.proxies[owner] = p
+	return p
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// vnodes is how many points each node gets on the ring. More points spread
+// rooms more evenly and move fewer of them when a node joins or leaves.
+const vnodes = 128
+
+// ring is a consistent hash ring over node URLs. Every node builds the same
+// ring from the same members, so they agree on owners without talking.
+type ring struct {
+	points []uint64
+	nodes  map[uint64]string
+}
+
+func newRing(nodes []string) *ring {
+	r := &ring{nodes: make(map[uint64]string, len(nodes)*vnodes)}
+	for _, n := range nodes {
+		for i := 0; i < vnodes; i++ {
+			h := hashKey(n + "#" + strconv.Itoa(i))
+			r.points = append(r.points, h)
+			r.nodes[h] = n
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the node at the first point clockwise from key.
+func (r *ring) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.nodes[r.points[i]]
+}
+
+func hashKey(s string) uint64 {
+	sum := sha1.Sum([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,136 @@
+package openrtb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"rtb/internal/auction"
+)
+
+// RequestData is the outgoing call an adapter wants made for one BidRequest.
+type RequestData struct {
+	Method  string
+	URI     string
+	Body    []byte
+	Headers http.Header
+}
+
+// ResponseData is what came back from the bidder.
+type ResponseData struct {
+	StatusCode int
+	Body       []byte
+	Headers    http.Header
+}
+
+// AdapterBid is one bid normalised by an adapter. Prices are in cents of the
+// exchange currency, like every other amount in the engine.
+type AdapterBid struct {
+	Bid        Bid
+	Seat       string
+	BidID      string // BidResponse.bidid, for ${AUCTION_BID_ID}
+	PriceCents int64
+}
+
+// Adapter translates between the exchange and one demand partner.
+type Adapter interface {
+	// MakeRequest builds the call for req.
+	MakeRequest(req *BidRequest) (*RequestData, error)
+	// ParseResponse extracts bids. A nil slice with a nil error is a no-bid.
+	ParseResponse(req *BidRequest, resp *ResponseData) ([]AdapterBid, error)
+}
+
+// Transport executes adapter requests. Adapters that answer in process
+// (such as the mock bidder) implement it themselves; everyone else goes over
+// HTTP.
+type Transport interface {
+	Do(ctx context.Context, req *RequestData) (*ResponseData, error)
+}
+
+// AdapterFactory builds an adapter from its registry entry.
+type AdapterFactory func(cfg BidderConfig) (Adapter, error)
+
+// httpTransport sends RequestData with a plain http.Client.
+type httpTransport struct {
+	client *http.Client
+}
+
+func (t httpTransport) Do(ctx context.Context, rd *RequestData) (*ResponseData, error) {
+	req, err := http.NewRequestWithContext(ctx, rd.Method, rd.URI, bytes.NewReader(rd.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range rd.Headers {
+		req.Header[k] = v
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseData{StatusCode: res.StatusCode, Body: body, Headers: res.Header}, nil
+}
+
+// openRTBAdapter forwards the request unchanged to an OpenRTB endpoint.
+type openRTBAdapter struct {
+	name     string
+	endpoint string
+}
+
+func newOpenRTBAdapter(cfg BidderConfig) (Adapter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("bidder %s: endpoint required", cfg.Name)
+	}
+	return &openRTBAdapter{name: cfg.Name, endpoint: cfg.Endpoint}, nil
+}
+
+func (a *openRTBAdapter) MakeRequest(req *BidRequest) (*RequestData, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Openrtb-Version", "2.5")
+	return &RequestData{Method: http.MethodPost, URI: a.endpoint, Body: body, Headers: h}, nil
+}
+
+func (a *openRTBAdapter) ParseResponse(req *BidRequest, resp *ResponseData) ([]AdapterBid, error) {
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var br BidResponse
+	if err := json.Unmarshal(resp.Body, &br); err != nil {
+		return nil, err
+	}
+	if br.Cur != "" && br.Cur != Currency {
+		return nil, fmt.Errorf("unsupported currency %q", br.Cur)
+	}
+	return bidsFromResponse(a.name, &br), nil
+}
+
+// bidsFromResponse flattens a BidResponse, defaulting the seat to the bidder
+// name and converting prices to cents.
+func bidsFromResponse(name string, br *BidResponse) []AdapterBid {
+	var out []AdapterBid
+	for _, sb := range br.SeatBid {
+		seat := sb.Seat
+		if seat == "" {
+			seat = name
+		}
+		for _, b := range sb.Bid {
+			out = append(out, AdapterBid{Bid: b, Seat: seat, BidID: br.BidID, PriceCents: auction.ToCents(b.Price)})
+		}
+	}
+	return out
+}
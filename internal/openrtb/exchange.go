@@ -0,0 +1,207 @@
+package openrtb
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"rtb/internal/auction"
+)
+
+// Currency is the only currency accepted from bidders and floors.
+const Currency = "USD"
+
+// Exchange fans a BidRequest out to the registry's bidders and runs one
+// auction per impression. Prices are compared in cents.
+type Exchange struct {
+	Registry *Registry
+	// DefaultTMax applies when the request carries no tmax.
+	DefaultTMax time.Duration
+	// notices fires win and loss URLs.
+	notices *http.Client
+}
+
+func NewExchange(reg *Registry) *Exchange {
+	return &Exchange{
+		Registry:    reg,
+		DefaultTMax: 200 * time.Millisecond,
+		notices:     &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// candidate is a bid received from one seat for one impression.
+type candidate struct {
+	AdapterBid
+	order int // bidder position; breaks price ties deterministically
+}
+
+// responseExt reports per-bidder latency and no-bid reasons to the caller.
+type responseExt struct {
+	ResponseTimeMillis map[string]int64  `json:"responsetimemillis"`
+	NoBids             map[string]string `json:"nobids,omitempty"`
+}
+
+// Run executes the auction and returns the winning bids, or nil when no
+// impression cleared.
+func (e *Exchange) Run(ctx context.Context, req *BidRequest) *BidResponse {
+	tmax := e.DefaultTMax
+	if req.TMax > 0 {
+		tmax = time.Duration(req.TMax) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, tmax)
+	defer cancel()
+
+	imps := make(map[string]bool, len(req.Imp))
+	for _, imp := range req.Imp {
+		imps[imp.ID] = true
+	}
+	ext := responseExt{ResponseTimeMillis: make(map[string]int64), NoBids: make(map[string]string)}
+	var cands []candidate
+	for _, res := range e.Registry.call(ctx, req) {
+		ext.ResponseTimeMillis[res.name] = res.latency.Milliseconds()
+		if res.noBid != "" {
+			ext.NoBids[res.name] = res.noBid
+		}
+		for _, b := range res.bids {
+			if !imps[b.Bid.ImpID] || b.PriceCents <= 0 {
+				continue
+			}
+			cands = append(cands, candidate{AdapterBid: b, order: res.order})
+		}
+	}
+
+	auctionType := req.AT
+	if auctionType != FirstPrice {
+		// OpenRTB defaults to second price plus.
+		auctionType = SecondPrice
+	}
+
+	bySeat := make(map[string][]Bid)
+	var seats []string
+	for _, imp := range req.Imp {
+		floor := auction.ToCents(imp.BidFloor)
+		var bids []candidate
+		for _, c := range cands {
+			if c.Bid.ImpID == imp.ID {
+				bids = append(bids, c)
+			}
+		}
+		winner, price, ok := clear(floor, bids, auctionType)
+		for _, c := range bids {
+			if ok && c.order == winner.order && c.Bid.ID == winner.Bid.ID {
+				continue
+			}
+			loss := LossLostToHigherBid
+			if c.PriceCents < floor {
+				loss = LossBelowFloor
+			}
+			e.notify(substitute(c.Bid.LURL, macros(req, c, price, loss)))
+		}
+		if !ok {
+			continue
+		}
+		m := macros(req, winner, price, LossWon)
+		won := winner.Bid
+		won.Price = auction.FromCents(price)
+		won.NURL = substitute(won.NURL, m)
+		won.BURL = substitute(won.BURL, m)
+		won.LURL = ""
+		won.AdM = substitute(won.AdM, m)
+		e.notify(won.NURL)
+		if _, seen := bySeat[winner.Seat]; !seen {
+			seats = append(seats, winner.Seat)
+		}
+		bySeat[winner.Seat] = append(bySeat[winner.Seat], won)
+	}
+	if len(seats) == 0 {
+		return nil
+	}
+
+	resp := &BidResponse{ID: req.ID, Cur: Currency}
+	for _, seat := range seats {
+		resp.SeatBid = append(resp.SeatBid, SeatBid{Seat: seat, Bid: bySeat[seat]})
+	}
+	if raw, err := json.Marshal(ext); err == nil {
+		resp.Ext = raw
+	}
+	return resp
+}
+
+// clear picks the winner among bids at or above the floor and computes the
+// clearing price in cents for the auction type.
+func clear(floor int64, bids []candidate, auctionType int) (candidate, int64, bool) {
+	eligible := make([]candidate, 0, len(bids))
+	for _, c := range bids {
+		if c.PriceCents >= floor {
+			eligible = append(eligible, c)
+		}
+	}
+	if len(eligible) == 0 {
+		return candidate{}, 0, false
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		if eligible[i].PriceCents != eligible[j].PriceCents {
+			return eligible[i].PriceCents > eligible[j].PriceCents
+		}
+		return eligible[i].order < eligible[j].order
+	})
+	winner := eligible[0]
+	if auctionType == FirstPrice {
+		return winner, winner.PriceCents, true
+	}
+	// Second price plus one cent, never below the floor nor above the winning bid.
+	price := floor
+	if len(eligible) > 1 {
+		price = max(price, eligible[1].PriceCents+1)
+	}
+	return winner, min(price, winner.PriceCents), true
+}
+
+// notify fires a win or loss notice without holding up the auction.
+func (e *Exchange) notify(url string) {
+	if url == "" {
+		return
+	}
+	go func() {
+		res, err := e.notices.Get(url)
+		if err != nil {
+			log.Printf("openrtb notice %s: %v", url, err)
+			return
+		}
+		_ = res.Body.Close()
+	}()
+}
+
+func macros(req *BidRequest, c candidate, priceCts int64, loss int) map[string]string {
+	mbr := ""
+	if c.PriceCents > 0 {
+		mbr = strconv.FormatFloat(float64(priceCts)/float64(c.PriceCents), 'f', 4, 64)
+	}
+	return map[string]string{
+		"${AUCTION_ID}":       req.ID,
+		"${AUCTION_BID_ID}":   c.BidID,
+		"${AUCTION_IMP_ID}":   c.Bid.ImpID,
+		"${AUCTION_SEAT_ID}":  c.Seat,
+		"${AUCTION_AD_ID}":    c.Bid.AdID,
+		"${AUCTION_PRICE}":    strconv.FormatFloat(auction.FromCents(priceCts), 'f', 2, 64),
+		"${AUCTION_CURRENCY}": Currency,
+		"${AUCTION_MBR}":      mbr,
+		"${AUCTION_LOSS}":     strconv.Itoa(loss),
+	}
+}
+
+func substitute(s string, macros map[string]string) string {
+	if s == "" || !strings.Contains(s, "${") {
+		return s
+	}
+	pairs := make([]string, 0, len(macros)*2)
+	for k, v := range macros {
+		pairs = append(pairs, k, v)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
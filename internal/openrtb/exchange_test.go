@@ -0,0 +1,88 @@
+package openrtb
+
+import "testing"
+
+// cand is a bid from the bidder at position order.
+func cand(id string, order int, cents int64) candidate {
+	return candidate{AdapterBid: AdapterBid{Bid: Bid{ID: id}, PriceCents: cents}, order: order}
+}
+
+func TestClear(t *testing.T) {
+	tests := []struct {
+		name        string
+		floor       int64
+		bids        []candidate
+		auctionType int
+		wantOK      bool
+		wantID      string
+		wantPrice   int64
+	}{
+		{
+			name:        "no bids",
+			floor:       100,
+			auctionType: SecondPrice,
+		},
+		{
+			name:        "all below the floor",
+			floor:       100,
+			bids:        []candidate{cand("a", 0, 99), cand("b", 1, 50)},
+			auctionType: SecondPrice,
+		},
+		{
+			name:        "first price pays the bid",
+			floor:       100,
+			bids:        []candidate{cand("a", 0, 300), cand("b", 1, 500)},
+			auctionType: FirstPrice,
+			wantOK:      true, wantID: "b", wantPrice: 500,
+		},
+		{
+			name:        "second price plus one cent",
+			floor:       100,
+			bids:        []candidate{cand("a", 0, 300), cand("b", 1, 500)},
+			auctionType: SecondPrice,
+			wantOK:      true, wantID: "b", wantPrice: 301,
+		},
+		{
+			name:        "lone bid pays the floor",
+			floor:       100,
+			bids:        []candidate{cand("a", 0, 500)},
+			auctionType: SecondPrice,
+			wantOK:      true, wantID: "a", wantPrice: 100,
+		},
+		{
+			name:        "runner-up below the floor does not set the price",
+			floor:       200,
+			bids:        []candidate{cand("a", 0, 150), cand("b", 1, 500)},
+			auctionType: SecondPrice,
+			wantOK:      true, wantID: "b", wantPrice: 200,
+		},
+		{
+			name:        "tie goes to the earlier bidder at the winning bid",
+			floor:       100,
+			bids:        []candidate{cand("late", 2, 400), cand("early", 1, 400)},
+			auctionType: SecondPrice,
+			wantOK:      true, wantID: "early", wantPrice: 400,
+		},
+		{
+			name:        "price plus one cent is capped at the winning bid",
+			floor:       100,
+			bids:        []candidate{cand("a", 0, 400), cand("b", 1, 400), cand("c", 2, 399)},
+			auctionType: SecondPrice,
+			wantOK:      true, wantID: "a", wantPrice: 400,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			winner, price, ok := clear(tt.floor, tt.bids, tt.auctionType)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if winner.Bid.ID != tt.wantID || price != tt.wantPrice {
+				t.Errorf("got %s at %d, want %s at %d", winner.Bid.ID, price, tt.wantID, tt.wantPrice)
+			}
+		})
+	}
+}
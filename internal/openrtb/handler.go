@@ -0,0 +1,65 @@
+package openrtb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// Handler serves POST /openrtb2/auction.
+type Handler struct {
+	Exchange *Exchange
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req BidRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		writeNoBid(w, http.StatusBadRequest, NBRInvalidRequest)
+		return
+	}
+	if !valid(&req) {
+		writeNoBid(w, http.StatusBadRequest, NBRInvalidRequest)
+		return
+	}
+
+	resp := h.Exchange.Run(r.Context(), &req)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Openrtb-Version", "2.5")
+	enc := json.NewEncoder(w)
+	// Markup and notice URLs go out verbatim.
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(resp)
+}
+
+// valid checks the parts of the request the exchange relies on. Floors and
+// allowed currencies must use the exchange currency; there is no FX.
+func valid(req *BidRequest) bool {
+	if req.ID == "" || len(req.Imp) == 0 {
+		return false
+	}
+	if len(req.Cur) > 0 && !slices.Contains(req.Cur, Currency) {
+		return false
+	}
+	seen := make(map[string]bool, len(req.Imp))
+	for _, imp := range req.Imp {
+		if imp.ID == "" || seen[imp.ID] || imp.BidFloor < 0 {
+			return false
+		}
+		if imp.BidFloorCur != "" && imp.BidFloorCur != Currency {
+			return false
+		}
+		seen[imp.ID] = true
+	}
+	return true
+}
+
+func writeNoBid(w http.ResponseWriter, status int, nbr int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(BidResponse{NBR: &nbr})
+}
@@ -0,0 +1,94 @@
+package openrtb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MockConfig drives the built-in local bidder.
+type MockConfig struct {
+	// PriceCents is bid on every impression whose floor it meets.
+	PriceCents int64 `json:"priceCents"`
+	// LatencyMs delays each answer to exercise timeouts.
+	LatencyMs int64 `json:"latencyMs,omitempty"`
+	// NURL and AdM may contain macros and are copied onto every bid.
+	NURL string `json:"nurl,omitempty"`
+	AdM  string `json:"adm,omitempty"`
+}
+
+// mockAdapter bids a fixed price without touching the network. It is its
+// own Transport.
+type mockAdapter struct {
+	name string
+	cfg  MockConfig
+}
+
+func newMockAdapter(cfg BidderConfig) (Adapter, error) {
+	m := MockConfig{PriceCents: 100}
+	if cfg.Mock != nil {
+		m = *cfg.Mock
+	}
+	return &mockAdapter{name: cfg.Name, cfg: m}, nil
+}
+
+func (a *mockAdapter) MakeRequest(req *BidRequest) (*RequestData, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestData{Method: http.MethodPost, URI: "mock://" + a.name, Body: body}, nil
+}
+
+func (a *mockAdapter) Do(ctx context.Context, rd *RequestData) (*ResponseData, error) {
+	if a.cfg.LatencyMs > 0 {
+		select {
+		case <-time.After(time.Duration(a.cfg.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var req BidRequest
+	if err := json.Unmarshal(rd.Body, &req); err != nil {
+		return nil, err
+	}
+	resp := BidResponse{ID: req.ID, BidID: a.name + "-" + req.ID}
+	var bids []Bid
+	for _, imp := range req.Imp {
+		price := float64(a.cfg.PriceCents) / 100
+		if price < imp.BidFloor {
+			continue
+		}
+		bids = append(bids, Bid{
+			ID:    a.name + "-" + imp.ID,
+			ImpID: imp.ID,
+			Price: price,
+			AdID:  a.name,
+			CrID:  a.name + "-creative",
+			NURL:  a.cfg.NURL,
+			AdM:   a.cfg.AdM,
+		})
+	}
+	if len(bids) == 0 {
+		return &ResponseData{StatusCode: http.StatusNoContent}, nil
+	}
+	resp.SeatBid = []SeatBid{{Seat: a.name, Bid: bids}}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseData{StatusCode: http.StatusOK, Body: body, Headers: http.Header{"Content-Length": {strconv.Itoa(len(body))}}}, nil
+}
+
+func (a *mockAdapter) ParseResponse(req *BidRequest, resp *ResponseData) ([]AdapterBid, error) {
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var br BidResponse
+	if err := json.Unmarshal(resp.Body, &br); err != nil {
+		return nil, err
+	}
+	return bidsFromResponse(a.name, &br), nil
+}
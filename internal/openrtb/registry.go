@@ -0,0 +1,265 @@
+package openrtb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// BidderConfig is one entry of the bidders file.
+type BidderConfig struct {
+	Name string `json:"name"`
+	// Adapter selects the factory: "openrtb" (HTTP passthrough) or "mock".
+	Adapter   string      `json:"adapter"`
+	Endpoint  string      `json:"endpoint,omitempty"`
+	TimeoutMs int64       `json:"timeoutMs,omitempty"`
+	QPS       int         `json:"qps,omitempty"` // 0 means unlimited
+	Mock      *MockConfig `json:"mock,omitempty"`
+}
+
+// No-bid reasons recorded per bidder.
+const (
+	NoBidEmpty       = "no_bid"
+	NoBidTimeout     = "timeout"
+	NoBidError       = "error"
+	NoBidInvalid     = "invalid_response"
+	NoBidQPSLimited  = "qps_limited"
+	NoBidBuildFailed = "request_error"
+)
+
+// BidderStats is a snapshot of one bidder's counters.
+type BidderStats struct {
+	Name          string           `json:"name"`
+	Requests      int64            `json:"requests"`
+	Sent          int64            `json:"sent"`
+	Bids          int64            `json:"bids"`
+	NoBids        map[string]int64 `json:"noBids"`
+	AvgLatencyMs  float64          `json:"avgLatencyMs"`
+	MaxLatencyMs  int64            `json:"maxLatencyMs"`
+	LastLatencyMs int64            `json:"lastLatencyMs"`
+}
+
+// Registry holds the configured bidders and the adapter factories used to
+// build them.
+type Registry struct {
+	factories map[string]AdapterFactory
+	bidders   []*bidder
+}
+
+type bidder struct {
+	cfg       BidderConfig
+	adapter   Adapter
+	transport Transport
+	timeout   time.Duration
+	limiter   *limiter
+
+	mu           sync.Mutex
+	stats        BidderStats
+	totalLatency time.Duration
+}
+
+// bidderResult is the outcome of calling one bidder for one request.
+type bidderResult struct {
+	name    string
+	order   int
+	bids    []AdapterBid
+	latency time.Duration
+	noBid   string
+}
+
+// NewRegistry returns an empty registry with the built-in adapters.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]AdapterFactory)}
+	r.RegisterAdapter("openrtb", newOpenRTBAdapter)
+	r.RegisterAdapter("mock", newMockAdapter)
+	return r
+}
+
+// LoadRegistry reads a JSON file of the form {"bidders": [BidderConfig...]}.
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Bidders []BidderConfig `json:"bidders"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r := NewRegistry()
+	for _, cfg := range file.Bidders {
+		if err := r.Register(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// RegisterAdapter makes a new adapter kind available to Register.
+func (r *Registry) RegisterAdapter(kind string, f AdapterFactory) {
+	r.factories[kind] = f
+}
+
+// Register builds and adds a bidder.
+func (r *Registry) Register(cfg BidderConfig) error {
+	if cfg.Name == "" {
+		return errors.New("bidder name required")
+	}
+	for _, b := range r.bidders {
+		if b.cfg.Name == cfg.Name {
+			return fmt.Errorf("bidder %s registered twice", cfg.Name)
+		}
+	}
+	f, ok := r.factories[cfg.Adapter]
+	if !ok {
+		return fmt.Errorf("bidder %s: unknown adapter %q", cfg.Name, cfg.Adapter)
+	}
+	a, err := f(cfg)
+	if err != nil {
+		return err
+	}
+	t, ok := a.(Transport)
+	if !ok {
+		t = httpTransport{client: &http.Client{}}
+	}
+	b := &bidder{
+		cfg:       cfg,
+		adapter:   a,
+		transport: t,
+		stats:     BidderStats{Name: cfg.Name, NoBids: make(map[string]int64)},
+	}
+	if cfg.TimeoutMs > 0 {
+		b.timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	if cfg.QPS > 0 {
+		b.limiter = newLimiter(cfg.QPS)
+	}
+	r.bidders = append(r.bidders, b)
+	return nil
+}
+
+// Stats returns a snapshot of every bidder's counters.
+func (r *Registry) Stats() []BidderStats {
+	out := make([]BidderStats, 0, len(r.bidders))
+	for _, b := range r.bidders {
+		b.mu.Lock()
+		s := b.stats
+		s.NoBids = make(map[string]int64, len(b.stats.NoBids))
+		for k, v := range b.stats.NoBids {
+			s.NoBids[k] = v
+		}
+		b.mu.Unlock()
+		out = append(out, s)
+	}
+	return out
+}
+
+// call runs every bidder concurrently; ctx carries the auction deadline.
+func (r *Registry) call(ctx context.Context, req *BidRequest) []bidderResult {
+	results := make([]bidderResult, len(r.bidders))
+	var wg sync.WaitGroup
+	for i, b := range r.bidders {
+		wg.Add(1)
+		go func(i int, b *bidder) {
+			defer wg.Done()
+			res := b.call(ctx, req)
+			res.order = i
+			b.record(res)
+			results[i] = res
+		}(i, b)
+	}
+	wg.Wait()
+	return results
+}
+
+func (b *bidder) call(ctx context.Context, req *BidRequest) bidderResult {
+	res := bidderResult{name: b.cfg.Name}
+	if b.limiter != nil && !b.limiter.allow(time.Now()) {
+		res.noBid = NoBidQPSLimited
+		return res
+	}
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	rd, err := b.adapter.MakeRequest(req)
+	if err != nil {
+		res.noBid = NoBidBuildFailed
+		return res
+	}
+	start := time.Now()
+	resp, err := b.transport.Do(ctx, rd)
+	res.latency = time.Since(start)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+		res.noBid = NoBidTimeout
+		return res
+	case err != nil:
+		res.noBid = NoBidError
+		return res
+	}
+	bids, err := b.adapter.ParseResponse(req, resp)
+	if err != nil {
+		res.noBid = NoBidInvalid
+		return res
+	}
+	if len(bids) == 0 {
+		res.noBid = NoBidEmpty
+		return res
+	}
+	res.bids = bids
+	return res
+}
+
+func (b *bidder) record(res bidderResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Requests++
+	if res.noBid != "" {
+		b.stats.NoBids[res.noBid]++
+	}
+	b.stats.Bids += int64(len(res.bids))
+	if res.latency == 0 {
+		// Never sent (throttled or unbuildable); no latency to record.
+		return
+	}
+	b.stats.Sent++
+	b.totalLatency += res.latency
+	ms := res.latency.Milliseconds()
+	b.stats.LastLatencyMs = ms
+	b.stats.MaxLatencyMs = max(b.stats.MaxLatencyMs, ms)
+	b.stats.AvgLatencyMs = float64(b.totalLatency.Microseconds()) / 1000 / float64(b.stats.Sent)
+}
+
+// limiter is a token bucket refilled at qps tokens per second.
+type limiter struct {
+	mu     sync.Mutex
+	qps    float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(qps int) *limiter {
+	return &limiter{qps: float64(qps), tokens: float64(qps)}
+}
+
+func (l *limiter) allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = min(l.qps, l.tokens+now.Sub(l.last).Seconds()*l.qps)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
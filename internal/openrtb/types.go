@@ -0,0 +1,97 @@
+package openrtb
+
+import "encoding/json"
+
+// OpenRTB 2.5/2.6 objects. Only the fields the exchange inspects are typed;
+// everything else is passed through to bidders untouched.
+
+// Auction types (BidRequest.at).
+const (
+	FirstPrice  = 1
+	SecondPrice = 2
+)
+
+type BidRequest struct {
+	ID      string          `json:"id"`
+	Imp     []Imp           `json:"imp"`
+	Site    json.RawMessage `json:"site,omitempty"`
+	App     json.RawMessage `json:"app,omitempty"`
+	Device  json.RawMessage `json:"device,omitempty"`
+	User    json.RawMessage `json:"user,omitempty"`
+	Test    int             `json:"test,omitempty"`
+	AT      int             `json:"at,omitempty"`
+	TMax    int64           `json:"tmax,omitempty"`
+	WSeat   []string        `json:"wseat,omitempty"`
+	BSeat   []string        `json:"bseat,omitempty"`
+	AllImps int             `json:"allimps,omitempty"`
+	Cur     []string        `json:"cur,omitempty"`
+	BCat    []string        `json:"bcat,omitempty"`
+	BAdv    []string        `json:"badv,omitempty"`
+	Source  json.RawMessage `json:"source,omitempty"`
+	Regs    json.RawMessage `json:"regs,omitempty"`
+	Ext     json.RawMessage `json:"ext,omitempty"`
+}
+
+type Imp struct {
+	ID          string          `json:"id"`
+	Banner      json.RawMessage `json:"banner,omitempty"`
+	Video       json.RawMessage `json:"video,omitempty"`
+	Audio       json.RawMessage `json:"audio,omitempty"`
+	Native      json.RawMessage `json:"native,omitempty"`
+	PMP         json.RawMessage `json:"pmp,omitempty"`
+	TagID       string          `json:"tagid,omitempty"`
+	BidFloor    float64         `json:"bidfloor,omitempty"`
+	BidFloorCur string          `json:"bidfloorcur,omitempty"`
+	Secure      *int            `json:"secure,omitempty"`
+	Ext         json.RawMessage `json:"ext,omitempty"`
+}
+
+type BidResponse struct {
+	ID         string          `json:"id"`
+	SeatBid    []SeatBid       `json:"seatbid,omitempty"`
+	BidID      string          `json:"bidid,omitempty"`
+	Cur        string          `json:"cur,omitempty"`
+	CustomData string          `json:"customdata,omitempty"`
+	NBR        *int            `json:"nbr,omitempty"`
+	Ext        json.RawMessage `json:"ext,omitempty"`
+}
+
+type SeatBid struct {
+	Bid   []Bid           `json:"bid"`
+	Seat  string          `json:"seat,omitempty"`
+	Group int             `json:"group,omitempty"`
+	Ext   json.RawMessage `json:"ext,omitempty"`
+}
+
+type Bid struct {
+	ID      string          `json:"id"`
+	ImpID   string          `json:"impid"`
+	Price   float64         `json:"price"`
+	NURL    string          `json:"nurl,omitempty"`
+	BURL    string          `json:"burl,omitempty"`
+	LURL    string          `json:"lurl,omitempty"`
+	AdM     string          `json:"adm,omitempty"`
+	AdID    string          `json:"adid,omitempty"`
+	ADomain []string        `json:"adomain,omitempty"`
+	CID     string          `json:"cid,omitempty"`
+	CrID    string          `json:"crid,omitempty"`
+	Cat     []string        `json:"cat,omitempty"`
+	DealID  string          `json:"dealid,omitempty"`
+	W       int64           `json:"w,omitempty"`
+	H       int64           `json:"h,omitempty"`
+	Ext     json.RawMessage `json:"ext,omitempty"`
+}
+
+// Loss reason codes (OpenRTB 2.5 list 5.25) used in ${AUCTION_LOSS}.
+const (
+	LossWon             = 0
+	LossBelowFloor      = 100
+	LossLostToHigherBid = 102
+)
+
+// No-bid reason codes (list 5.24) used in BidResponse.nbr.
+const (
+	NBRUnknownError   = 0
+	NBRTechnicalError = 1
+	NBRInvalidRequest = 2
+)
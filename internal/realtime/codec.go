@@ -0,0 +1,62 @@
+package realtime
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Wire encodings. JSON is the default; clients opt into MessagePack with
+// the WebSocket subprotocol or the DataChannel label. Both carry the same
+// fields under the same names; see docs/realtime-protocol.md.
+const (
+	SubprotocolJSON    = "rtb.v1.json"
+	SubprotocolMsgpack = "rtb.v1.msgpack"
+
+	LabelJSON    = "rtb-v1"
+	LabelMsgpack = "rtb-v1-bin"
+	// The tick channels are opened unordered with maxRetransmits 0 next to
+	// a reliable one and carry room_patch and presence only.
+	LabelTicks        = "rtb-v1-ticks"
+	LabelTicksMsgpack = "rtb-v1-ticks-bin"
+)
+
+// codec encodes messages for one connection.
+type codec struct {
+	// binary frames the messages as binary rather than text.
+	binary    bool
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+var jsonCodec = codec{marshal: json.Marshal, unmarshal: json.Unmarshal}
+
+var msgpackCodec = codec{binary: true, marshal: msgpackMarshal, unmarshal: msgpackUnmarshal}
+
+// codecFor picks the codec for a negotiated WebSocket subprotocol.
+func codecFor(subprotocol string) codec {
+	if subprotocol == SubprotocolMsgpack {
+		return msgpackCodec
+	}
+	return jsonCodec
+}
+
+// msgpackMarshal encodes v with its JSON field names, so both encodings
+// share one schema.
+func msgpackMarshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackUnmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
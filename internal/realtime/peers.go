@@ -0,0 +1,198 @@
+package realtime
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+var (
+	ErrTooManySessions     = errors.New("too many webrtc sessions")
+	ErrTooManyUserSessions = errors.New("too many webrtc sessions for user")
+	ErrTooManyIPSessions   = errors.New("too many webrtc sessions from address")
+)
+
+// PeerLimits bounds WebRTC sessions. Zero counts are unlimited.
+type PeerLimits struct {
+	Total   int
+	PerUser int
+	PerIP   int
+	// OpenTimeout closes peer connections whose reliable DataChannel has
+	// not opened by then.
+	OpenTimeout time.Duration
+}
+
+// PeerRegistry owns the server's peer connections from signaling until
+// they fail, close or time out, and enforces PeerLimits.
+type PeerRegistry struct {
+	limits PeerLimits
+
+	mu     sync.Mutex
+	peers  map[string]*peer
+	nextID int
+}
+
+func NewPeerRegistry(limits PeerLimits) *PeerRegistry {
+	return &PeerRegistry{limits: limits, peers: make(map[string]*peer)}
+}
+
+// peer is one registered session. Its state fields are guarded by the
+// registry's mu.
+type peer struct {
+	id        string
+	userID    string
+	ip        string
+	createdAt time.Time
+	pc        *webrtc.PeerConnection
+	iceState  webrtc.ICEConnectionState
+	// opened is set once a reliable channel opens; a tick channel alone
+	// carries no requests and does not count.
+	opened    bool
+	channels  int
+	closeOnce sync.Once
+}
+
+// PeerInfo describes a live session for operators.
+type PeerInfo struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+	ICEState  string    `json:"iceState"`
+	// Channels counts the session's open DataChannels.
+	Channels int `json:"channels"`
+}
+
+// PeerStats is what the admin endpoint reports.
+type PeerStats struct {
+	Total    int            `json:"total"`
+	ByUser   map[string]int `json:"byUser"`
+	ByIP     map[string]int `json:"byIp"`
+	ICEState map[string]int `json:"iceStates"`
+	Sessions []PeerInfo     `json:"sessions"`
+}
+
+// admit reserves a session for userID connecting from ip, or refuses it
+// when a limit is reached.
+func (reg *PeerRegistry) admit(userID, ip string) (*peer, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var byUser, byIP int
+	for _, p := range reg.peers {
+		if p.userID == userID {
+			byUser++
+		}
+		if p.ip == ip {
+			byIP++
+		}
+	}
+	switch {
+	case reg.limits.Total > 0 && len(reg.peers) >= reg.limits.Total:
+		return nil, ErrTooManySessions
+	case reg.limits.PerUser > 0 && byUser >= reg.limits.PerUser:
+		return nil, ErrTooManyUserSessions
+	case reg.limits.PerIP > 0 && byIP >= reg.limits.PerIP:
+		return nil, ErrTooManyIPSessions
+	}
+	reg.nextID++
+	p := &peer{
+		id:        strconv.Itoa(reg.nextID),
+		userID:    userID,
+		ip:        ip,
+		createdAt: time.Now().UTC(),
+		iceState:  webrtc.ICEConnectionStateNew,
+	}
+	reg.peers[p.id] = p
+	return p, nil
+}
+
+// track hands pc to the registry, which closes it when it fails or its
+// DataChannel does not open within OpenTimeout.
+func (reg *PeerRegistry) track(p *peer, pc *webrtc.PeerConnection) {
+	reg.mu.Lock()
+	p.pc = pc
+	reg.mu.Unlock()
+	pc.OnICEConnectionStateChange(func(st webrtc.ICEConnectionState) {
+		reg.mu.Lock()
+		p.iceState = st
+		reg.mu.Unlock()
+	})
+	pc.OnConnectionStateChange(func(st webrtc.PeerConnectionState) {
+		if st == webrtc.PeerConnectionStateFailed || st == webrtc.PeerConnectionStateClosed {
+			reg.drop(p)
+		}
+	})
+	if reg.limits.OpenTimeout > 0 {
+		time.AfterFunc(reg.limits.OpenTimeout, func() {
+			reg.mu.Lock()
+			opened := p.opened
+			reg.mu.Unlock()
+			if !opened {
+				log.Printf("webrtc session %s (user %s): reliable data channel did not open in %s", p.id, p.userID, reg.limits.OpenTimeout)
+				reg.drop(p)
+			}
+		})
+	}
+}
+
+// channelOpened and channelClosed count the session's open DataChannels.
+// reliable marks the rtb-v1 channels that carry the session.
+func (reg *PeerRegistry) channelOpened(p *peer, reliable bool) {
+	reg.mu.Lock()
+	if reliable {
+		p.opened = true
+	}
+	p.channels++
+	reg.mu.Unlock()
+}
+
+func (reg *PeerRegistry) channelClosed(p *peer) {
+	reg.mu.Lock()
+	p.channels--
+	reg.mu.Unlock()
+}
+
+// drop forgets the session and closes its peer connection.
+func (reg *PeerRegistry) drop(p *peer) {
+	reg.mu.Lock()
+	delete(reg.peers, p.id)
+	pc := p.pc
+	reg.mu.Unlock()
+	if pc != nil {
+		// Close blocks on pion's own callbacks, which may be what called drop.
+		p.closeOnce.Do(func() { go pc.Close() })
+	}
+}
+
+// Stats reports the live sessions, oldest first.
+func (reg *PeerRegistry) Stats() PeerStats {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	st := PeerStats{
+		Total:    len(reg.peers),
+		ByUser:   make(map[string]int),
+		ByIP:     make(map[string]int),
+		ICEState: make(map[string]int),
+		Sessions: make([]PeerInfo, 0, len(reg.peers)),
+	}
+	for _, p := range reg.peers {
+		st.ByUser[p.userID]++
+		st.ByIP[p.ip]++
+		st.ICEState[p.iceState.String()]++
+		st.Sessions = append(st.Sessions, PeerInfo{
+			ID:        p.id,
+			UserID:    p.userID,
+			IP:        p.ip,
+			CreatedAt: p.createdAt,
+			ICEState:  p.iceState.String(),
+			Channels:  p.channels,
+		})
+	}
+	sort.Slice(st.Sessions, func(i, j int) bool { return st.Sessions[i].CreatedAt.Before(st.Sessions[j].CreatedAt) })
+	return st
+}
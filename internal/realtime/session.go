@@ -0,0 +1,219 @@
+package realtime
+
+import (
+	"sync"
+
+	"rtb/internal/auction"
+)
+
+// clientMsg is any message a client sends. ClientMsgID is optional and is
+// echoed in the ack or nack for that message. Epoch and LastSeq are only
+// read from resume: the epoch and seq of the last room broadcast the client
+// received.
+type clientMsg struct {
+	Type        string `json:"type"`
+	RoomID      string `json:"roomId"`
+	AmountCts   int64  `json:"amountCents"`
+	ClientMsgID string `json:"clientMsgId,omitempty"`
+	Epoch       string `json:"epoch,omitempty"`
+	LastSeq     int64  `json:"lastSeq"`
+}
+
+// maxRooms caps how many rooms one connection may follow at once.
+const maxRooms = 100
+
+// session is one authenticated realtime connection, over a WebSocket or a
+// DataChannel. The transport feeds it client messages and writes whatever
+// arrives on out: broadcasts from every room it follows, each tagged with
+// its RoomID, and replies meant for this client only.
+type session struct {
+	mgr   *auction.Manager
+	user  *auction.User
+	codec codec
+
+	out chan auction.Outbound
+	// done closes when the session ends; kicked when a room evicted it
+	// for being too slow and the transport should drop the connection.
+	done      chan struct{}
+	kicked    chan struct{}
+	closeOnce sync.Once
+	kickOnce  sync.Once
+
+	mu   sync.Mutex
+	subs map[string]*subscription
+}
+
+// subscription ties a session to one room it joined.
+type subscription struct {
+	room   *auction.Room
+	cancel func()
+	// left closes when the client leaves, so the end of the event stream is
+	// not mistaken for an eviction.
+	left chan struct{}
+}
+
+func newSession(mgr *auction.Manager, user *auction.User, c codec) *session {
+	return &session{
+		mgr:    mgr,
+		user:   user,
+		codec:  c,
+		out:    make(chan auction.Outbound, 256),
+		done:   make(chan struct{}),
+		kicked: make(chan struct{}),
+		subs:   make(map[string]*subscription),
+	}
+}
+
+// handle routes one client message. subscribe and unsubscribe are the
+// multi-room names for join_room and leave_room; a connection may follow
+// up to maxRooms rooms at once.
+func (s *session) handle(data []byte) {
+	var m clientMsg
+	if err := s.codec.unmarshal(data, &m); err != nil {
+		s.nack(m, "invalid_message")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := s.subs[m.RoomID]
+	switch m.Type {
+	case "join_room", "subscribe":
+		if sub != nil {
+			s.nack(m, "already_joined")
+			return
+		}
+		if len(s.subs) >= maxRooms {
+			s.nack(m, "too_many_rooms")
+			return
+		}
+		if s.redirect(m) {
+			return
+		}
+		room := s.mgr.RoomFor(m.RoomID)
+		if room == nil {
+			s.nack(m, "room_not_found")
+			return
+		}
+		_, events, cancel := room.Subscribe()
+		s.follow(m.RoomID, room, events, cancel)
+		room.Input() <- s.event(m)
+	case "resume":
+		// Joins like join_room after a reconnect, or re-syncs a joined
+		// room after the client spotted a gap in seq.
+		if sub == nil && len(s.subs) >= maxRooms {
+			s.nack(m, "too_many_rooms")
+			return
+		}
+		if s.redirect(m) {
+			return
+		}
+		room := s.mgr.RoomFor(m.RoomID)
+		if room == nil {
+			s.nack(m, "room_not_found")
+			return
+		}
+		if sub != nil {
+			s.leave(m.RoomID)
+		}
+		_, events, cancel := room.Resume(m.Epoch, m.LastSeq)
+		s.follow(m.RoomID, room, events, cancel)
+		room.Input() <- s.event(m)
+	case "leave_room", "unsubscribe":
+		if sub == nil {
+			s.nack(m, "not_joined")
+			return
+		}
+		sub.room.Input() <- s.event(m)
+		s.leave(m.RoomID)
+	case "place_bid", "set_max_bid", "snapshot":
+		if sub == nil {
+			s.nack(m, "not_joined")
+			return
+		}
+		sub.room.Input() <- s.event(m)
+	default:
+		s.nack(m, "unknown_type")
+	}
+}
+
+// follow starts forwarding a room's events. Callers hold s.mu.
+func (s *session) follow(roomID string, room *auction.Room, events <-chan auction.Outbound, cancel func()) {
+	sub := &subscription{room: room, cancel: cancel, left: make(chan struct{})}
+	s.subs[roomID] = sub
+	go s.forward(sub, events)
+}
+
+func (s *session) event(m clientMsg) auction.Event {
+	return auction.Event{Type: m.Type, User: s.user, AmountCts: m.AmountCts, ClientMsgID: m.ClientMsgID, Reply: s.out}
+}
+
+// nack refuses a message the session could not route to a room.
+func (s *session) nack(m clientMsg, reason string) {
+	s.refuse(m, map[string]any{"reason": reason})
+}
+
+// redirect refuses joining a room another cluster node runs with
+// wrong_node, naming the owner so the client can connect there.
+func (s *session) redirect(m clientMsg) bool {
+	owner, local := s.mgr.Owner(m.RoomID)
+	if local {
+		return false
+	}
+	s.refuse(m, map[string]any{"reason": "wrong_node", "owner": owner})
+	return true
+}
+
+func (s *session) refuse(m clientMsg, payload map[string]any) {
+	payload["requestType"] = m.Type
+	if m.ClientMsgID != "" {
+		payload["clientMsgId"] = m.ClientMsgID
+	}
+	select {
+	case s.out <- auction.Outbound{Type: "nack", RoomID: m.RoomID, Payload: payload}:
+	default:
+	}
+}
+
+// forward copies room broadcasts to out until the subscription ends.
+func (s *session) forward(sub *subscription, events <-chan auction.Outbound) {
+	for ev := range events {
+		select {
+		case <-sub.left:
+			// Replaced or left; a resumed subscription sends from here on.
+			return
+		default:
+		}
+		select {
+		case s.out <- ev:
+		case <-s.done:
+			return
+		}
+	}
+	select {
+	case <-sub.left:
+	case <-s.done:
+	default:
+		s.kickOnce.Do(func() { close(s.kicked) })
+	}
+}
+
+// leave unsubscribes from a joined room. Callers hold s.mu.
+func (s *session) leave(roomID string) {
+	sub := s.subs[roomID]
+	close(sub.left)
+	sub.cancel()
+	delete(s.subs, roomID)
+}
+
+// close tells every joined room the user left and stops forwarding.
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		for id, sub := range s.subs {
+			sub.room.Input() <- auction.Event{Type: "leave_room", User: s.user}
+			s.leave(id)
+		}
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
@@ -0,0 +1,88 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rtb/internal/auction"
+)
+
+// SSEHandler streams a room's broadcasts as Server-Sent Events for
+// spectators. It is read-only: no token is needed and watchers are not
+// counted as participants. Each event is named after the message type and
+// carries the room epoch and seq as its id, "<epoch>-<seq>", so EventSource
+// reconnects resume through Last-Event-ID.
+type SSEHandler struct {
+	Mgr *auction.Manager
+}
+
+// ServeRoom streams the room until the client goes away or falls too far
+// behind, in which case it is expected to reconnect.
+func (h *SSEHandler) ServeRoom(w http.ResponseWriter, r *http.Request, roomID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	room := h.Mgr.RoomFor(roomID)
+	if room == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	epoch, lastSeq := "", int64(-1)
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		// For clients that cannot set headers on reconnect.
+		id = r.URL.Query().Get("lastEventId")
+	}
+	if id != "" {
+		e, s, _ := strings.Cut(id, "-")
+		seq, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || seq < 0 {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		epoch, lastSeq = e, seq
+	}
+
+	_, events, cancel := room.Resume(epoch, lastSeq)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep buffering proxies such as nginx from holding events back.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case out, ok := <-events:
+			if !ok {
+				// Evicted for being too slow.
+				return
+			}
+			data, err := json.Marshal(out)
+			if err != nil {
+				continue
+			}
+			if out.Epoch != "" {
+				fmt.Fprintf(w, "id: %s-%d\n", out.Epoch, out.Seq)
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", out.Type, data)
+			flusher.Flush()
+		case <-ticker.C:
+			// Comment line so idle proxies do not time the stream out.
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
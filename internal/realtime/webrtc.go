@@ -1,118 +1,165 @@
 package realtime
 
 import (
-	"encoding/json"
 	"log"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/webrtc/v3"
 	"rtb/internal/auction"
+	"rtb/internal/users"
 )
 
-type SignalWS struct {
-	Mgr *auction.Manager
-}
+// signalTimeout bounds how long the signaling socket stays open for the
+// offer and trickled candidates.
+const signalTimeout = 30 * time.Second
 
-type offerMsg struct {
-	Type   string `json:"type"`
-	SDP    string `json:"sdp"`
+// SignalWS negotiates DataChannel sessions. The token is checked on the
+// signaling upgrade and its user is bound to the resulting peer connection,
+// which Peers owns from then on.
+type SignalWS struct {
+	Mgr   *auction.Manager
+	Users *users.Service
+	Peers *PeerRegistry
+	// ICEServers are the STUN/TURN servers the server side gathers
+	// candidates with; clients fetch the same list from the API.
+	ICEServers []webrtc.ICEServer
 }
 
-type answerMsg struct {
-	Type string `json:"type"`
-	SDP  string `json:"sdp"`
+// signalMsg is any message on the signaling socket. Offers with Trickle set
+// get their answer right away and candidates follow as candidate messages;
+// other offers are answered once gathering completes. A candidate message
+// without a candidate marks the end of a side's candidates.
+type signalMsg struct {
+	Type      string                   `json:"type"`
+	SDP       string                   `json:"sdp,omitempty"`
+	Trickle   bool                     `json:"trickle,omitempty"`
+	Candidate *webrtc.ICECandidateInit `json:"candidate,omitempty"`
 }
 
 func (s *SignalWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	account, err := s.Users.Authenticate(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user := account.Participant()
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	p, err := s.Peers.admit(user.ID, ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	// Until signaling succeeds the session is ours to clean up.
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			s.Peers.drop(p)
+		}
+	}()
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, "upgrade failed", http.StatusBadRequest)
 		return
 	}
 	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(signalTimeout))
 
-	// Read offer
-	_, data, err := conn.ReadMessage()
-	if err != nil {
-		return
+	// Pion calls OnICECandidate from its own goroutine.
+	var writeMu sync.Mutex
+	send := func(m signalMsg) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = conn.WriteJSON(m)
 	}
-	var offer offerMsg
-	if err := json.Unmarshal(data, &offer); err != nil || offer.Type != "offer" || offer.SDP == "" {
+
+	// Read offer
+	var offer signalMsg
+	if err := conn.ReadJSON(&offer); err != nil || offer.Type != "offer" || offer.SDP == "" {
 		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"expected offer"}`))
 		return
 	}
 
 	api := webrtc.NewAPI()
-	pc, err := api.NewPeerConnection(webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-		},
-	})
+	pc, err := api.NewPeerConnection(webrtc.Configuration{ICEServers: s.ICEServers})
 	if err != nil {
 		log.Printf("pc create: %v", err)
 		return
 	}
-	defer pc.Close()
+	s.Peers.track(p, pc)
 
 	// DataChannel handling
-	var room *auction.Room
-	var user *auction.User
-	var cancelSub func()
-
+	ticks := &tickChannel{}
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
-		if dc.Label() != "rtb-v1" {
+		var c codec
+		switch dc.Label() {
+		case LabelJSON:
+			c = jsonCodec
+		case LabelMsgpack:
+			c = msgpackCodec
+		case LabelTicks, LabelTicksMsgpack:
+			// Send-only; anything the client writes here is ignored.
+			c = jsonCodec
+			if dc.Label() == LabelTicksMsgpack {
+				c = msgpackCodec
+			}
+			dc.OnOpen(func() {
+				s.Peers.channelOpened(p, false)
+				ticks.set(dc, c)
+			})
+			dc.OnClose(func() {
+				ticks.set(nil, c)
+				s.Peers.channelClosed(p)
+			})
+			return
+		default:
 			return
 		}
-		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-			var envelope struct {
-				Type      string         `json:"type"`
-				RoomID    string         `json:"roomId"`
-				User      auction.User   `json:"user"`
-				AmountCts int64          `json:"amountCents"`
-			}
-			if err := json.Unmarshal(msg.Data, &envelope); err != nil {
-				return
-			}
-			switch envelope.Type {
-			case "join_room":
-				user = &auction.User{ID: envelope.User.ID, Handle: envelope.User.Handle}
-				room = s.Mgr.RoomFor(envelope.RoomID)
-				if room == nil {
-					_ = dc.SendText(`{"type":"error","message":"room_not_found"}`)
-					return
-				}
-				_, events, cancel := room.Subscribe()
-				cancelSub = cancel
-				room.Input() <- auction.Event{Type: "join_room", User: user}
-				// writer for outbound
-				go func() {
-					for out := range events {
-						bytes, _ := json.Marshal(out)
-						_ = dc.SendText(string(bytes))
+		sess := newSession(s.Mgr, user, c)
+		dc.OnOpen(func() {
+			s.Peers.channelOpened(p, true)
+			defer s.Peers.channelClosed(p)
+			for {
+				select {
+				case out := <-sess.out:
+					if tickType(out.Type) && ticks.send(out) {
+						continue
 					}
-				}()
-			case "place_bid":
-				if room != nil && user != nil {
-					room.Input() <- auction.Event{Type: "place_bid", User: user, AmountCts: envelope.AmountCts}
-				}
-			case "leave_room":
-				if room != nil && user != nil {
-					room.Input() <- auction.Event{Type: "leave_room", User: user}
+					if err := sendOutbound(dc, c, out); err != nil {
+						log.Printf("encode %s: %v", out.Type, err)
+					}
+				case <-sess.kicked:
+					_ = dc.Close()
+					return
+				case <-sess.done:
+					return
 				}
 			}
 		})
-		dc.OnClose(func() {
-			if room != nil && user != nil {
-				room.Input() <- auction.Event{Type: "leave_room", User: user}
-			}
-			if cancelSub != nil {
-				cancelSub()
-			}
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+			sess.handle(msg.Data)
 		})
+		dc.OnClose(sess.close)
 	})
 
+	if offer.Trickle {
+		pc.OnICECandidate(func(cand *webrtc.ICECandidate) {
+			m := signalMsg{Type: "candidate"}
+			if cand != nil {
+				init := cand.ToJSON()
+				m.Candidate = &init
+			}
+			send(m)
+		})
+	}
+
 	// Set remote offer
 	if err := pc.SetRemoteDescription(webrtc.SessionDescription{
 		Type: webrtc.SDPTypeOffer,
@@ -126,21 +173,87 @@ func (s *SignalWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		log.Printf("create answer: %v", err)
 		return
 	}
-	gather := webrtc.GatheringCompletePromise(pc)
-	if err := pc.SetLocalDescription(answer); err != nil {
-		log.Printf("set local: %v", err)
-		return
+	if offer.Trickle {
+		// Hold writes so no candidate overtakes the answer.
+		writeMu.Lock()
+		err = pc.SetLocalDescription(answer)
+		if err == nil {
+			_ = conn.WriteJSON(signalMsg{Type: "answer", SDP: answer.SDP})
+		}
+		writeMu.Unlock()
+		if err != nil {
+			log.Printf("set local: %v", err)
+			return
+		}
+	} else {
+		gather := webrtc.GatheringCompletePromise(pc)
+		if err := pc.SetLocalDescription(answer); err != nil {
+			log.Printf("set local: %v", err)
+			return
+		}
+		<-gather
+		send(signalMsg{Type: "answer", SDP: pc.LocalDescription().SDP})
 	}
-	<-gather
-	local := pc.LocalDescription()
 
-	resp := answerMsg{Type: "answer", SDP: local.SDP}
-	bytes, _ := json.Marshal(resp)
-	_ = conn.WriteMessage(websocket.TextMessage, bytes)
+	// Take the client's trickled candidates until it hangs up or the
+	// signaling window ends.
+	for {
+		var m signalMsg
+		if err := conn.ReadJSON(&m); err != nil {
+			break
+		}
+		if m.Type != "candidate" || m.Candidate == nil {
+			continue
+		}
+		if err := pc.AddICECandidate(*m.Candidate); err != nil {
+			log.Printf("add candidate: %v", err)
+		}
+	}
+	// The registry closes the peer connection when it fails or never
+	// opens a channel.
+	handedOff = true
+}
+
+// tickChannel is the optional unordered, unreliable DataChannel of a peer
+// connection. When it is open, periodic state carries over it so a lost
+// packet never holds up bids on the reliable channel.
+type tickChannel struct {
+	mu    sync.Mutex
+	dc    *webrtc.DataChannel
+	codec codec
+}
+
+func (t *tickChannel) set(dc *webrtc.DataChannel, c codec) {
+	t.mu.Lock()
+	t.dc, t.codec = dc, c
+	t.mu.Unlock()
+}
 
-	// Keep the websocket around a bit to ensure client receives the answer.
-	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	_, _, _ = conn.ReadMessage()
+// send reports whether out went over the tick channel.
+func (t *tickChannel) send(out auction.Outbound) bool {
+	t.mu.Lock()
+	dc, c := t.dc, t.codec
+	t.mu.Unlock()
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return false
+	}
+	return sendOutbound(dc, c, out) == nil
 }
 
+// tickType reports whether messages of type typ may be lost: the room
+// already drops them for slow subscribers, and clients recover from a gap
+// in room_patch versions with a snapshot.
+func tickType(typ string) bool {
+	return typ == "room_patch" || typ == "presence"
+}
 
+func sendOutbound(dc *webrtc.DataChannel, c codec, out auction.Outbound) error {
+	bytes, err := c.marshal(out)
+	if err != nil {
+		return err
+	}
+	if c.binary {
+		return dc.Send(bytes)
+	}
+	return dc.SendText(string(bytes))
+}
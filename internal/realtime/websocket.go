@@ -1,41 +1,38 @@
 package realtime
 
 import (
-	"context"
-	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"rtb/internal/auction"
+	"rtb/internal/users"
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  4096,
 	WriteBufferSize: 4096,
+	// Preferred first; clients that ask for neither get JSON.
+	Subprotocols: []string{SubprotocolMsgpack, SubprotocolJSON},
 	// Allow any origin for demo purposes.
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// WSHandler serves the realtime protocol. Connections must present a token
+// from Users; the user it names bids for the lifetime of the connection.
 type WSHandler struct {
-	Mgr *auction.Manager
-}
-
-type clientJoin struct {
-	Type   string         `json:"type"`
-	RoomID string         `json:"roomId"`
-	User   auction.User   `json:"user"`
-}
-
-type clientBid struct {
-	Type      string       `json:"type"`
-	RoomID    string       `json:"roomId"`
-	User      auction.User `json:"user"`
-	AmountCts int64        `json:"amountCents"`
+	Mgr   *auction.Manager
+	Users *users.Service
 }
 
 func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	account, err := h.Users.Authenticate(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, "upgrade failed", http.StatusBadRequest)
@@ -49,52 +46,34 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return nil
 	})
 
-	// Expect a join message first
-	var join clientJoin
-	_, data, err := conn.ReadMessage()
-	if err != nil {
-		log.Printf("ws read join: %v", err)
-		return
-	}
-	if err := json.Unmarshal(data, &join); err != nil || join.Type != "join_room" || join.RoomID == "" || join.User.ID == "" {
-		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"expected join_room"}`))
-		return
+	c := codecFor(conn.Subprotocol())
+	frame := websocket.TextMessage
+	if c.binary {
+		frame = websocket.BinaryMessage
 	}
-
-	room := h.Mgr.RoomFor(join.RoomID)
-	if room == nil {
-		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"room_not_found"}`))
-		return
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	subID, events, cancelSub := room.Subscribe()
-	defer cancelSub()
-
-	// Notify join
-	room.Input() <- auction.Event{Type: "join_room", User: &auction.User{ID: join.User.ID, Handle: join.User.Handle}}
+	sess := newSession(h.Mgr, account.Participant(), c)
+	defer sess.close()
 
 	// writer goroutine
-	done := make(chan struct{})
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
-		defer func() {
-			ticker.Stop()
-			close(done)
-		}()
+		defer ticker.Stop()
 		for {
 			select {
-			case out, ok := <-events:
-				if !ok {
-					return
+			case out := <-sess.out:
+				bytes, err := c.marshal(out)
+				if err != nil {
+					log.Printf("encode %s: %v", out.Type, err)
+					continue
 				}
-				bytes, _ := json.Marshal(out)
-				_ = conn.WriteMessage(websocket.TextMessage, bytes)
+				_ = conn.WriteMessage(frame, bytes)
 			case <-ticker.C:
 				_ = conn.WriteMessage(websocket.PingMessage, []byte("ping"))
-			case <-ctx.Done():
+			case <-sess.kicked:
+				// Too slow for the room; the client reconnects and resumes from its last seq.
+				_ = conn.Close()
+				return
+			case <-sess.done:
 				return
 			}
 		}
@@ -106,25 +85,6 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			break
 		}
-		// naive routing on "type"
-		var t struct{ Type string `json:"type"` }
-		if err := json.Unmarshal(msg, &t); err != nil {
-			continue
-		}
-		switch t.Type {
-		case "place_bid":
-			var b clientBid
-			if json.Unmarshal(msg, &b) == nil {
-				room.Input() <- auction.Event{Type: "place_bid", User: &auction.User{ID: b.User.ID, Handle: b.User.Handle}, AmountCts: b.AmountCts}
-			}
-		case "leave_room":
-			room.Input() <- auction.Event{Type: "leave_room", User: &join.User}
-		}
+		sess.handle(msg)
 	}
-
-	// goodbye
-	_ = subID
-	room.Input() <- auction.Event{Type: "leave_room", User: &join.User}
 }
-
-
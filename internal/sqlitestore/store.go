@@ -0,0 +1,412 @@
+// Package sqlitestore implements the auction and user stores on an embedded
+// SQLite database (pure Go driver, no cgo) so historical auctions and bids
+// can be queried with SQL.
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"rtb/internal/auction"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS auctions (
+	id                         TEXT PRIMARY KEY,
+	title                      TEXT NOT NULL,
+	format                     TEXT NOT NULL,
+	status                     TEXT NOT NULL,
+	start_price_cents          INTEGER NOT NULL,
+	min_increment_cents        INTEGER NOT NULL,
+	reserve_price_cents        INTEGER NOT NULL,
+	starts_at                  TEXT NOT NULL,
+	ends_at                    TEXT NOT NULL,
+	soft_close_seconds         INTEGER NOT NULL,
+	decrement_cents            INTEGER NOT NULL DEFAULT 0,
+	decrement_interval_seconds INTEGER NOT NULL DEFAULT 0,
+	floor_price_cents          INTEGER NOT NULL DEFAULT 0,
+	created_at                 TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS auctions_unfinished ON auctions (created_at)
+	WHERE status NOT IN ('settled', 'cancelled');
+CREATE TABLE IF NOT EXISTS bids (
+	auction_id      TEXT NOT NULL,
+	seq             INTEGER NOT NULL,
+	user_id         TEXT NOT NULL,
+	handle          TEXT NOT NULL,
+	amount_cents    INTEGER NOT NULL,
+	accepted        INTEGER NOT NULL,
+	reason          TEXT NOT NULL DEFAULT '',
+	auto            INTEGER NOT NULL DEFAULT 0,
+	created_at      TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (auction_id, seq)
+);
+CREATE INDEX IF NOT EXISTS bids_user ON bids (user_id);
+CREATE TABLE IF NOT EXISTS settlements (
+	auction_id          TEXT PRIMARY KEY,
+	winner_user_id      TEXT NOT NULL DEFAULT '',
+	winner_handle       TEXT NOT NULL DEFAULT '',
+	hammer_price_cents  INTEGER NOT NULL,
+	high_bid_cents      INTEGER NOT NULL,
+	reserve_price_cents INTEGER NOT NULL,
+	reserve_met         INTEGER NOT NULL,
+	bid_count           INTEGER NOT NULL,
+	closed_at           TEXT NOT NULL,
+	ranking             TEXT NOT NULL DEFAULT '[]'
+);
+CREATE TABLE IF NOT EXISTS users (
+	id            TEXT PRIMARY KEY,
+	handle        TEXT NOT NULL,
+	handle_key    TEXT NOT NULL UNIQUE,
+	display_name  TEXT NOT NULL,
+	verified      INTEGER NOT NULL DEFAULT 0,
+	password_hash BLOB NOT NULL,
+	created_at    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS wallets (
+	user_id            TEXT PRIMARY KEY,
+	balance_cents      INTEGER NOT NULL,
+	credit_limit_cents INTEGER NOT NULL,
+	holds              TEXT NOT NULL DEFAULT '{}',
+	updated_at         TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS ledger (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id       TEXT NOT NULL,
+	type          TEXT NOT NULL,
+	amount_cents  INTEGER NOT NULL,
+	auction_id    TEXT NOT NULL DEFAULT '',
+	balance_cents INTEGER NOT NULL,
+	created_at    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ledger_user ON ledger (user_id, id);
+`
+
+// Times are stored as fixed-width RFC 3339 text in UTC, so they sort and
+// compare in SQL. RFC3339Nano would trim trailing zeros and put
+// "...:05Z" after "...:05.5Z".
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// parseTime also reads the variable-width times of older databases.
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// timeColumns are rewritten to timeFormat when a database is opened.
+var timeColumns = []struct{ table, column string }{
+	{"auctions", "starts_at"},
+	{"auctions", "ends_at"},
+	{"auctions", "created_at"},
+	{"bids", "created_at"},
+	{"settlements", "closed_at"},
+	{"users", "created_at"},
+	{"wallets", "updated_at"},
+	{"ledger", "created_at"},
+}
+
+// Store implements auction.AuctionStore, auction.BidStore, users.Store and
+// wallet.Store.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens or creates the database at path and applies the schema.
+func Open(path string) (*Store, error) {
+	// Transactions begin IMMEDIATE: they take the write lock up front, so
+	// read-modify-write updates from several processes never interleave.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; a single connection avoids SQLITE_BUSY churn.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := normalizeTimes(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// addedColumns were added to the schema after its tables were first created.
+var addedColumns = []struct{ table, column, def string }{
+	{"bids", "idempotency_key", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// addColumns brings tables created by older versions up to the schema.
+func addColumns(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var n int
+		if err := db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column + ` ` + c.def); err != nil {
+			return fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+		}
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS bids_key ON bids (auction_id, user_id, idempotency_key) WHERE idempotency_key != ''`)
+	return err
+}
+
+// normalizeTimes rewrites times stored in any other layout, as databases
+// written before timeFormat was fixed-width have them, so they sort.
+func normalizeTimes(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	width := len(formatTime(time.Time{}))
+	for _, c := range timeColumns {
+		rows, err := tx.Query(`SELECT rowid, `+c.column+` FROM `+c.table+` WHERE length(`+c.column+`) != ? OR `+c.column+` NOT LIKE '%Z'`, width)
+		if err != nil {
+			return err
+		}
+		fixed := map[int64]string{}
+		for rows.Next() {
+			var (
+				id int64
+				v  string
+			)
+			if err := rows.Scan(&id, &v); err != nil {
+				rows.Close()
+				return err
+			}
+			t, err := parseTime(v)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("%s.%s: %w", c.table, c.column, err)
+			}
+			fixed[id] = formatTime(t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, v := range fixed {
+			if _, err := tx.Exec(`UPDATE `+c.table+` SET `+c.column+` = ? WHERE rowid = ?`, v, id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Durable reports that the database outlives the process, so the journal
+// may forget finished auctions once they are stored here.
+func (s *Store) Durable() bool {
+	return true
+}
+
+func (s *Store) PutAuction(a *auction.Auction) error {
+	_, err := s.db.Exec(`
+		INSERT INTO auctions (id, title, format, status, start_price_cents, min_increment_cents,
+			reserve_price_cents, starts_at, ends_at, soft_close_seconds, decrement_cents,
+			decrement_interval_seconds, floor_price_cents, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			title = excluded.title,
+			status = excluded.status,
+			ends_at = excluded.ends_at`,
+		a.ID, a.Title, string(a.Format), string(a.Status), a.StartPriceCents, a.MinIncrementCents,
+		a.ReservePriceCents, formatTime(a.StartsAt), formatTime(a.EndsAt), a.SoftCloseSeconds,
+		a.DecrementCents, a.DecrementIntervalSeconds, a.FloorPriceCents, formatTime(a.CreatedAt))
+	return err
+}
+
+const auctionColumns = `id, title, format, status, start_price_cents, min_increment_cents,
+	reserve_price_cents, starts_at, ends_at, soft_close_seconds, decrement_cents,
+	decrement_interval_seconds, floor_price_cents, created_at`
+
+func (s *Store) GetAuction(id string) (*auction.Auction, error) {
+	a, err := scanAuction(s.db.QueryRow(`SELECT `+auctionColumns+` FROM auctions WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auction.ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) ListAuctions() ([]*auction.Auction, error) {
+	return s.listAuctions(``)
+}
+
+func (s *Store) ListUnfinishedAuctions() ([]*auction.Auction, error) {
+	return s.listAuctions(`WHERE status NOT IN ('settled', 'cancelled')
+		AND NOT (status = 'closed' AND id IN (SELECT auction_id FROM settlements))`)
+}
+
+func (s *Store) listAuctions(where string) ([]*auction.Auction, error) {
+	rows, err := s.db.Query(`SELECT ` + auctionColumns + ` FROM auctions ` + where + ` ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*auction.Auction
+	for rows.Next() {
+		a, err := scanAuction(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAuction(sc scanner) (*auction.Auction, error) {
+	var (
+		a                         auction.Auction
+		format, status            string
+		startsAt, endsAt, created string
+	)
+	err := sc.Scan(&a.ID, &a.Title, &format, &status, &a.StartPriceCents, &a.MinIncrementCents,
+		&a.ReservePriceCents, &startsAt, &endsAt, &a.SoftCloseSeconds, &a.DecrementCents,
+		&a.DecrementIntervalSeconds, &a.FloorPriceCents, &created)
+	if err != nil {
+		return nil, err
+	}
+	a.Format = auction.Format(format)
+	a.Status = auction.Status(status)
+	if a.StartsAt, err = parseTime(startsAt); err != nil {
+		return nil, err
+	}
+	if a.EndsAt, err = parseTime(endsAt); err != nil {
+		return nil, err
+	}
+	if a.CreatedAt, err = parseTime(created); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *Store) PutSettlement(st *auction.Settlement) error {
+	ranking, err := json.Marshal(st.Ranking)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO settlements (auction_id, winner_user_id, winner_handle, hammer_price_cents,
+			high_bid_cents, reserve_price_cents, reserve_met, bid_count, closed_at, ranking)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		st.AuctionID, st.WinnerUserID, st.WinnerHandle, st.HammerPriceCents, st.HighBidCents,
+		st.ReservePriceCents, st.ReserveMet, st.BidCount, formatTime(st.ClosedAt), string(ranking))
+	return err
+}
+
+func (s *Store) GetSettlement(auctionID string) (*auction.Settlement, error) {
+	var (
+		st       auction.Settlement
+		closedAt string
+		ranking  string
+	)
+	err := s.db.QueryRow(`
+		SELECT auction_id, winner_user_id, winner_handle, hammer_price_cents, high_bid_cents,
+			reserve_price_cents, reserve_met, bid_count, closed_at, ranking
+		FROM settlements WHERE auction_id = ?`, auctionID).Scan(
+		&st.AuctionID, &st.WinnerUserID, &st.WinnerHandle, &st.HammerPriceCents, &st.HighBidCents,
+		&st.ReservePriceCents, &st.ReserveMet, &st.BidCount, &closedAt, &ranking)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, auction.ErrNotSettled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if st.ClosedAt, err = parseTime(closedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(ranking), &st.Ranking); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (s *Store) AppendBid(auctionID string, b auction.BidView) error {
+	_, err := s.db.Exec(`
+		INSERT OR IGNORE INTO bids (auction_id, seq, user_id, handle, amount_cents, accepted, reason, auto, created_at, idempotency_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		auctionID, b.Seq, b.UserID, b.Handle, b.AmountCts, b.Accepted, b.Reason, b.Auto, formatTime(b.CreatedAt), b.IdempotencyKey)
+	return err
+}
+
+func (s *Store) ListBids(auctionID string) ([]auction.BidView, error) {
+	rows, err := s.db.Query(`
+		SELECT seq, user_id, handle, amount_cents, accepted, reason, auto, created_at, idempotency_key
+		FROM bids WHERE auction_id = ? ORDER BY seq`, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanBids(rows)
+}
+
+func (s *Store) QueryBids(auctionID string, q auction.BidQuery) ([]auction.BidView, error) {
+	query := `
+		SELECT seq, user_id, handle, amount_cents, accepted, reason, auto, created_at, idempotency_key
+		FROM bids WHERE auction_id = ? AND seq > ?`
+	args := []any{auctionID, q.AfterSeq}
+	if q.UserID != "" {
+		query += ` AND user_id = ?`
+		args = append(args, q.UserID)
+	}
+	if q.Accepted != nil {
+		query += ` AND accepted = ?`
+		args = append(args, *q.Accepted)
+	}
+	if q.IdempotencyKey != "" {
+		query += ` AND idempotency_key = ?`
+		args = append(args, q.IdempotencyKey)
+	}
+	query += ` ORDER BY seq LIMIT ?`
+	args = append(args, q.Limit)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBids(rows)
+}
+
+func scanBids(rows *sql.Rows) ([]auction.BidView, error) {
+	defer rows.Close()
+	var out []auction.BidView
+	for rows.Next() {
+		var (
+			b       auction.BidView
+			created string
+			err     error
+		)
+		if err = rows.Scan(&b.Seq, &b.UserID, &b.Handle, &b.AmountCts, &b.Accepted, &b.Reason, &b.Auto, &created, &b.IdempotencyKey); err != nil {
+			return nil, err
+		}
+		if b.CreatedAt, err = parseTime(created); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
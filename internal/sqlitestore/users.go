@@ -0,0 +1,71 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"rtb/internal/users"
+)
+
+func (s *Store) CreateUser(u *users.User) error {
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, handle, handle_key, display_name, verified, password_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Handle, users.HandleKey(u.Handle), u.DisplayName, u.Verified, u.PasswordHash, formatTime(u.CreatedAt))
+	if isUniqueViolation(err) {
+		return users.ErrHandleTaken
+	}
+	return err
+}
+
+const userColumns = `id, handle, display_name, verified, password_hash, created_at`
+
+func (s *Store) GetUser(id string) (*users.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *Store) GetUserByHandle(handle string) (*users.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE handle_key = ?`, users.HandleKey(handle)))
+}
+
+func (s *Store) UpdateUser(u *users.User) error {
+	res, err := s.db.Exec(`
+		UPDATE users SET handle = ?, handle_key = ?, display_name = ?, verified = ?, password_hash = ?
+		WHERE id = ?`,
+		u.Handle, users.HandleKey(u.Handle), u.DisplayName, u.Verified, u.PasswordHash, u.ID)
+	if isUniqueViolation(err) {
+		return users.ErrHandleTaken
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return users.ErrNotFound
+	}
+	return nil
+}
+
+func scanUser(sc scanner) (*users.User, error) {
+	var (
+		u       users.User
+		created string
+	)
+	err := sc.Scan(&u.ID, &u.Handle, &u.DisplayName, &u.Verified, &u.PasswordHash, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, users.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.CreatedAt, err = parseTime(created); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// isUniqueViolation reports a UNIQUE constraint failure. The driver's error
+// codes live in an internal package, so match on the message.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,109 @@
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"rtb/internal/wallet"
+)
+
+func (s *Store) GetAccount(userID string) (*wallet.Account, error) {
+	return getAccount(s.db, userID)
+}
+
+// queryer is a *sql.DB or a *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getAccount(q queryer, userID string) (*wallet.Account, error) {
+	var (
+		a              wallet.Account
+		holds, updated string
+	)
+	err := q.QueryRow(`
+		SELECT user_id, balance_cents, credit_limit_cents, holds, updated_at
+		FROM wallets WHERE user_id = ?`, userID).Scan(
+		&a.UserID, &a.BalanceCents, &a.CreditLimitCents, &holds, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, wallet.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(holds), &a.Holds); err != nil {
+		return nil, err
+	}
+	if a.UpdatedAt, err = parseTime(updated); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// UpdateAccount runs in an immediate transaction (see Open), which takes
+// the database's write lock before reading, so processes sharing the file
+// apply their updates one after another.
+func (s *Store) UpdateAccount(userID string, fn func(a *wallet.Account) (*wallet.Account, *wallet.Entry, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	cur, err := getAccount(tx, userID)
+	if errors.Is(err, wallet.ErrNotFound) {
+		cur, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	a, e, err := fn(cur)
+	if err != nil || a == nil {
+		return err
+	}
+	holds, err := json.Marshal(a.Holds)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO wallets (user_id, balance_cents, credit_limit_cents, holds, updated_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, a.BalanceCents, a.CreditLimitCents, string(holds), formatTime(a.UpdatedAt)); err != nil {
+		return err
+	}
+	if e != nil {
+		if _, err := tx.Exec(`
+			INSERT INTO ledger (user_id, type, amount_cents, auction_id, balance_cents, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, string(e.Type), e.AmountCents, e.AuctionID, e.BalanceCents, formatTime(e.CreatedAt)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListEntries(userID string) ([]wallet.Entry, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id, type, amount_cents, auction_id, balance_cents, created_at
+		FROM ledger WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []wallet.Entry
+	for rows.Next() {
+		var (
+			e            wallet.Entry
+			typ, created string
+		)
+		if err := rows.Scan(&e.UserID, &typ, &e.AmountCents, &e.AuctionID, &e.BalanceCents, &created); err != nil {
+			return nil, err
+		}
+		e.Type = wallet.EntryType(typ)
+		if e.CreatedAt, err = parseTime(created); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
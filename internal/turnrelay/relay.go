@@ -0,0 +1,140 @@
+// Package turnrelay runs an embedded TURN server so WebRTC clients behind
+// symmetric NATs or UDP-blocking firewalls can reach the DataChannel
+// without a third-party relay. Credentials are short-lived and derived from
+// the session token secret: the username is "<expiry>:<user id>" and the
+// password an HMAC of it, in the style of the TURN REST API.
+package turnrelay
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+// Config describes the relay. It listens for UDP and TCP on the same port.
+type Config struct {
+	// ListenAddr is the host:port to listen on, e.g. ":3478".
+	ListenAddr string
+	// PublicIP is the address clients reach the relay on; relayed
+	// candidates are allocated on it.
+	PublicIP string
+	Realm    string
+	// Secret is the session token secret; the credential key is derived
+	// from it.
+	Secret []byte
+}
+
+// Relay is a running TURN server.
+type Relay struct {
+	server   *turn.Server
+	key      []byte
+	urls     []string
+	publicIP net.IP
+}
+
+// Start listens on cfg.ListenAddr and serves until Close.
+func Start(cfg Config) (*Relay, error) {
+	ip := net.ParseIP(cfg.PublicIP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid public ip %q", cfg.PublicIP)
+	}
+	_, port, err := net.SplitHostPort(cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	udp, err := net.ListenPacket("udp4", cfg.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp4", cfg.ListenAddr)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	r := &Relay{key: deriveKey(cfg.Secret), publicIP: ip}
+	gen := &turn.RelayAddressGeneratorStatic{RelayAddress: ip, Address: "0.0.0.0"}
+	r.server, err = turn.NewServer(turn.ServerConfig{
+		Realm:             cfg.Realm,
+		AuthHandler:       r.authenticate,
+		PacketConnConfigs: []turn.PacketConnConfig{{PacketConn: udp, RelayAddressGenerator: gen, PermissionHandler: r.permit}},
+		ListenerConfigs:   []turn.ListenerConfig{{Listener: tcp, RelayAddressGenerator: gen, PermissionHandler: r.permit}},
+	})
+	if err != nil {
+		udp.Close()
+		tcp.Close()
+		return nil, err
+	}
+	host := net.JoinHostPort(ip.String(), port)
+	r.urls = []string{"turn:" + host + "?transport=udp", "turn:" + host + "?transport=tcp"}
+	return r, nil
+}
+
+func (r *Relay) Close() error {
+	return r.server.Close()
+}
+
+// Credentials returns the relay as an ICE server usable by userID until
+// expires, normally the expiry of the user's session token.
+func (r *Relay) Credentials(userID string, expires time.Time) webrtc.ICEServer {
+	username := strconv.FormatInt(expires.Unix(), 10) + ":" + userID
+	return webrtc.ICEServer{URLs: r.urls, Username: username, Credential: r.password(username)}
+}
+
+func (r *Relay) authenticate(username, realm string, src net.Addr) ([]byte, bool) {
+	exp, _, ok := strings.Cut(username, ":")
+	if !ok {
+		return nil, false
+	}
+	t, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= t {
+		log.Printf("turn: rejected expired or malformed username %q from %s", username, src)
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, r.password(username)), true
+}
+
+// permit lets clients relay only to this host, where the one WebRTC endpoint
+// they may reach runs: its public address and its interface addresses.
+// Loopback, link-local and every other host, such as the rest of a private
+// network, are refused.
+func (r *Relay) permit(client net.Addr, peer net.IP) bool {
+	if !peer.IsLoopback() && !peer.IsLinkLocalUnicast() && !peer.IsUnspecified() {
+		if peer.Equal(r.publicIP) {
+			return true
+		}
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			log.Printf("turn: interface addresses: %v", err)
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.IP.Equal(peer) {
+				return true
+			}
+		}
+	}
+	log.Printf("turn: refused relay from %s to %s", client, peer)
+	return false
+}
+
+func (r *Relay) password(username string) string {
+	mac := hmac.New(sha1.New, r.key)
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// deriveKey keeps TURN credentials from doubling as token signatures.
+func deriveKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("turn"))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,169 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"rtb/internal/auth"
+)
+
+// Service implements account operations on top of a Store and issues
+// session tokens for logged-in users.
+type Service struct {
+	// mu serializes read-modify-write profile updates.
+	mu     sync.Mutex
+	store  Store
+	issuer *auth.Issuer
+}
+
+func NewService(store Store, issuer *auth.Issuer) *Service {
+	return &Service{store: store, issuer: issuer}
+}
+
+type RegisterParams struct {
+	Handle      string
+	DisplayName string
+	Password    string
+}
+
+// Session is returned by registration and login.
+type Session struct {
+	Token     string    `json:"token"`
+	User      *User     `json:"user"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (s *Service) Register(p RegisterParams) (*User, error) {
+	p.Handle = strings.TrimSpace(p.Handle)
+	if !ValidHandle(p.Handle) {
+		return nil, ErrInvalidHandle
+	}
+	if len(p.Password) < 8 {
+		return nil, ErrWeakPassword
+	}
+	if len(p.Password) > 72 {
+		return nil, ErrLongPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(p.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	displayName := strings.TrimSpace(p.DisplayName)
+	if displayName == "" {
+		displayName = p.Handle
+	}
+	u := &User{
+		ID:           "u-" + randomID(),
+		Handle:       p.Handle,
+		DisplayName:  displayName,
+		CreatedAt:    time.Now().UTC(),
+		PasswordHash: hash,
+	}
+	if err := s.store.CreateUser(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Login checks a handle and password. Unknown handles and wrong passwords
+// both report ErrInvalidCredentials.
+func (s *Service) Login(handle, password string) (*User, error) {
+	u, err := s.store.GetUserByHandle(strings.TrimSpace(handle))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// Session issues a token for u.
+func (s *Service) Session(u *User) (*Session, error) {
+	token, claims, err := s.issuer.Issue(*u.Participant())
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Token: token, User: u, ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC()}, nil
+}
+
+func (s *Service) Get(id string) (*User, error) {
+	return s.store.GetUser(id)
+}
+
+// ProfileUpdate lists the fields a user may change; nil leaves a field as is.
+type ProfileUpdate struct {
+	Handle      *string
+	DisplayName *string
+}
+
+func (s *Service) UpdateProfile(id string, p ProfileUpdate) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.store.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Handle != nil {
+		h := strings.TrimSpace(*p.Handle)
+		if !ValidHandle(h) {
+			return nil, ErrInvalidHandle
+		}
+		u.Handle = h
+	}
+	if p.DisplayName != nil {
+		if u.DisplayName = strings.TrimSpace(*p.DisplayName); u.DisplayName == "" {
+			u.DisplayName = u.Handle
+		}
+	}
+	if err := s.store.UpdateUser(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SetVerified marks an account as verified by an operator.
+func (s *Service) SetVerified(id string, verified bool) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.store.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	u.Verified = verified
+	if err := s.store.UpdateUser(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Authenticate resolves the account behind the request's session token. The
+// profile is loaded fresh, so handle changes and verification show up on the
+// next connection without a new token.
+func (s *Service) Authenticate(r *http.Request) (*User, error) {
+	claims, err := s.issuer.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.store.GetUser(claims.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return nil, auth.ErrInvalidToken
+	}
+	return u, err
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
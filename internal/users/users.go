@@ -0,0 +1,130 @@
+// Package users manages bidder accounts: registration, password login and
+// public profiles. Accounts give bidders a stable identity across sessions
+// and guarantee handles are unique.
+package users
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"rtb/internal/auction"
+)
+
+var (
+	ErrNotFound      = errors.New("user not found")
+	ErrHandleTaken   = errors.New("handle already taken")
+	ErrInvalidHandle = errors.New("handle must be 3-32 letters, digits, '_', '-' or '.'")
+	ErrWeakPassword  = errors.New("password must be at least 8 characters")
+	// ErrLongPassword is bcrypt's limit; longer passwords cannot be hashed.
+	ErrLongPassword       = errors.New("password must be at most 72 bytes")
+	ErrInvalidCredentials = errors.New("invalid handle or password")
+)
+
+type User struct {
+	ID          string    `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"displayName"`
+	Verified    bool      `json:"verified"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// PasswordHash is a bcrypt hash and never leaves the server.
+	PasswordHash []byte `json:"-"`
+}
+
+// Participant is the identity the auction engine sees for u.
+func (u *User) Participant() *auction.User {
+	return &auction.User{ID: u.ID, Handle: u.Handle, DisplayName: u.DisplayName, Verified: u.Verified}
+}
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+func ValidHandle(h string) bool {
+	return handlePattern.MatchString(h)
+}
+
+// HandleKey folds a handle for uniqueness checks, so "Alice" and "alice"
+// cannot both register.
+func HandleKey(h string) string {
+	return strings.ToLower(h)
+}
+
+// Store persists accounts. Implementations return copies.
+type Store interface {
+	// CreateUser returns ErrHandleTaken if the handle is in use.
+	CreateUser(u *User) error
+	// GetUser and GetUserByHandle return ErrNotFound for unknown users.
+	GetUser(id string) (*User, error)
+	GetUserByHandle(handle string) (*User, error)
+	// UpdateUser replaces an existing user; ErrHandleTaken if a new handle is in use.
+	UpdateUser(u *User) error
+}
+
+// MemoryStore keeps accounts in maps; they are lost on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	byID     map[string]*User
+	byHandle map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID:     make(map[string]*User),
+		byHandle: make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) CreateUser(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := HandleKey(u.Handle)
+	if _, ok := s.byHandle[key]; ok {
+		return ErrHandleTaken
+	}
+	cp := *u
+	s.byID[u.ID] = &cp
+	s.byHandle[key] = u.ID
+	return nil
+}
+
+func (s *MemoryStore) GetUser(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *MemoryStore) GetUserByHandle(handle string) (*User, error) {
+	s.mu.RLock()
+	id, ok := s.byHandle[HandleKey(handle)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.GetUser(id)
+}
+
+func (s *MemoryStore) UpdateUser(u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.byID[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	oldKey, newKey := HandleKey(old.Handle), HandleKey(u.Handle)
+	if oldKey != newKey {
+		if _, taken := s.byHandle[newKey]; taken {
+			return ErrHandleTaken
+		}
+		delete(s.byHandle, oldKey)
+		s.byHandle[newKey] = u.ID
+	}
+	cp := *u
+	s.byID[u.ID] = &cp
+	return nil
+}
@@ -0,0 +1,149 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"rtb/internal/auction"
+)
+
+// Ledger applies wallet operations. Every change is one atomic store update,
+// so a check and the hold that follows it cannot interleave with another
+// room, even one running on another node.
+type Ledger struct {
+	store Store
+	// defaultCredit is the credit limit of wallets created on first use.
+	defaultCredit int64
+}
+
+func NewLedger(store Store, defaultCreditCents int64) *Ledger {
+	return &Ledger{store: store, defaultCredit: defaultCreditCents}
+}
+
+// errUnchanged ends an update without writing anything.
+var errUnchanged = errors.New("wallet unchanged")
+
+// open returns a, or a new wallet with the default credit limit for users
+// who have none.
+func (l *Ledger) open(userID string, a *Account) *Account {
+	if a == nil {
+		return &Account{UserID: userID, CreditLimitCents: l.defaultCredit, Holds: map[string]int64{}}
+	}
+	if a.Holds == nil {
+		a.Holds = map[string]int64{}
+	}
+	return a
+}
+
+// update applies fn to the user's wallet and saves it with the entry fn
+// returns, if any.
+func (l *Ledger) update(userID string, fn func(a *Account) (*Entry, error)) (*Account, error) {
+	var saved *Account
+	err := l.store.UpdateAccount(userID, func(a *Account) (*Account, *Entry, error) {
+		a = l.open(userID, a)
+		e, err := fn(a)
+		if err != nil {
+			return nil, nil, err
+		}
+		now := time.Now().UTC()
+		a.UpdatedAt = now
+		if e != nil {
+			e.UserID = a.UserID
+			e.BalanceCents = a.BalanceCents
+			e.CreatedAt = now
+		}
+		saved = a
+		return a, e, nil
+	})
+	if errors.Is(err, errUnchanged) {
+		err = nil
+	}
+	return saved, err
+}
+
+func (l *Ledger) Account(userID string) (*Account, error) {
+	a, err := l.store.GetAccount(userID)
+	if errors.Is(err, ErrNotFound) {
+		a, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.open(userID, a), nil
+}
+
+func (l *Ledger) Entries(userID string) ([]Entry, error) {
+	return l.store.ListEntries(userID)
+}
+
+func (l *Ledger) Deposit(userID string, cents int64) (*Account, error) {
+	return l.update(userID, func(a *Account) (*Entry, error) {
+		a.BalanceCents += cents
+		return &Entry{Type: EntryDeposit, AmountCents: cents}, nil
+	})
+}
+
+func (l *Ledger) SetCreditLimit(userID string, cents int64) (*Account, error) {
+	return l.update(userID, func(a *Account) (*Entry, error) {
+		a.CreditLimitCents = cents
+		return &Entry{Type: EntryCreditLimit, AmountCents: cents}, nil
+	})
+}
+
+// CanCover reports whether the user could hold cents on the auction. An
+// existing hold on the same auction counts towards it, since a new hold
+// replaces it. Hold checks again when it reserves the money.
+func (l *Ledger) CanCover(userID, auctionID string, cents int64) error {
+	a, err := l.Account(userID)
+	if err != nil {
+		return err
+	}
+	return covers(a, auctionID, cents)
+}
+
+func covers(a *Account, auctionID string, cents int64) error {
+	if a.AvailableCents()+a.Holds[auctionID] < cents {
+		return auction.ErrInsufficientFunds
+	}
+	return nil
+}
+
+// Hold reserves cents for the user's bid on the auction, replacing any
+// earlier hold there.
+func (l *Ledger) Hold(userID, auctionID string, cents int64) error {
+	_, err := l.update(userID, func(a *Account) (*Entry, error) {
+		if err := covers(a, auctionID, cents); err != nil {
+			return nil, err
+		}
+		a.Holds[auctionID] = cents
+		return nil, nil
+	})
+	return err
+}
+
+// Release drops the user's hold on the auction, if any.
+func (l *Ledger) Release(userID, auctionID string) error {
+	_, err := l.update(userID, func(a *Account) (*Entry, error) {
+		if _, ok := a.Holds[auctionID]; !ok {
+			return nil, errUnchanged
+		}
+		delete(a.Holds, auctionID)
+		return nil, nil
+	})
+	return err
+}
+
+// Capture turns the user's hold on the auction into a charge of cents,
+// which may be less than was held. Without a hold it does nothing, so a
+// close replayed after a crash does not charge twice.
+func (l *Ledger) Capture(userID, auctionID string, cents int64) error {
+	_, err := l.update(userID, func(a *Account) (*Entry, error) {
+		if _, ok := a.Holds[auctionID]; !ok {
+			return nil, errUnchanged
+		}
+		delete(a.Holds, auctionID)
+		a.BalanceCents -= cents
+		return &Entry{Type: EntryCharge, AmountCents: cents, AuctionID: auctionID}, nil
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+// Package wallet keeps each bidder's balance, credit limit and the holds
+// placed on their live bids. It implements auction.Funds, so rooms refuse
+// bids a bidder cannot cover.
+package wallet
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("wallet not found")
+
+// Account is a bidder's wallet. Holds reserve part of the spending power
+// for bids that may still win, keyed by auction id.
+type Account struct {
+	UserID           string           `json:"userId"`
+	BalanceCents     int64            `json:"balanceCents"`
+	CreditLimitCents int64            `json:"creditLimitCents"`
+	Holds            map[string]int64 `json:"holds"`
+	UpdatedAt        time.Time        `json:"updatedAt"`
+}
+
+func (a *Account) HeldCents() int64 {
+	var n int64
+	for _, c := range a.Holds {
+		n += c
+	}
+	return n
+}
+
+// AvailableCents is what the bidder can still commit to new bids. Charges
+// may take the balance negative down to the credit limit.
+func (a *Account) AvailableCents() int64 {
+	return a.BalanceCents + a.CreditLimitCents - a.HeldCents()
+}
+
+func (a *Account) clone() *Account {
+	cp := *a
+	cp.Holds = make(map[string]int64, len(a.Holds))
+	for k, v := range a.Holds {
+		cp.Holds[k] = v
+	}
+	return &cp
+}
+
+type EntryType string
+
+const (
+	EntryDeposit     EntryType = "deposit"
+	EntryCharge      EntryType = "charge"
+	EntryCreditLimit EntryType = "credit_limit"
+)
+
+// Entry is one line of a bidder's ledger. Holds are not entries; only
+// money that moved (or a changed limit) is recorded.
+type Entry struct {
+	UserID       string    `json:"userId"`
+	Type         EntryType `json:"type"`
+	AmountCents  int64     `json:"amountCents"`
+	AuctionID    string    `json:"auctionId,omitempty"`
+	BalanceCents int64     `json:"balanceCents"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Store persists wallets and their ledgers. Implementations return copies.
+type Store interface {
+	// GetAccount returns ErrNotFound for users without a wallet yet.
+	GetAccount(userID string) (*Account, error)
+	// UpdateAccount passes fn the user's wallet, nil if they have none yet,
+	// and saves the account fn returns together with its entry, if any, as
+	// one atomic step: no other update of the wallet, from this process or
+	// any other sharing the store, comes in between. A nil account leaves
+	// the wallet as it was.
+	UpdateAccount(userID string, fn func(a *Account) (*Account, *Entry, error)) error
+	// ListEntries returns a user's ledger oldest first.
+	ListEntries(userID string) ([]Entry, error)
+}
+
+// MemoryStore keeps wallets in maps; they are lost on restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	accounts map[string]*Account
+	entries  map[string][]Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string]*Account),
+		entries:  make(map[string][]Entry),
+	}
+}
+
+func (s *MemoryStore) GetAccount(userID string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return a.clone(), nil
+}
+
+func (s *MemoryStore) UpdateAccount(userID string, fn func(a *Account) (*Account, *Entry, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cur *Account
+	if a, ok := s.accounts[userID]; ok {
+		cur = a.clone()
+	}
+	a, e, err := fn(cur)
+	if err != nil || a == nil {
+		return err
+	}
+	s.accounts[userID] = a.clone()
+	if e != nil {
+		s.entries[userID] = append(s.entries[userID], *e)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListEntries(userID string) ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Entry(nil), s.entries[userID]...), nil
+}
@@ -1,10 +1,11 @@
 "use client";
 
-import { useEffect, useMemo, useRef, useState } from "react";
-import { centsToDisplay } from "../../../lib/api";
+import { useEffect, useRef, useState } from "react";
+import { centsToDisplay, login, register, type Session } from "../../../lib/api";
 import { connectRealtime, type RTBMessage, type RealtimeConn } from "../../../lib/realtime";
 
 type RoomState = {
+  version: number;
   auctionId: string;
   title: string;
   currentPriceCents: number;
@@ -15,7 +16,9 @@ type RoomState = {
   minIncrementCents: number;
   participants: number;
   reservePriceCents: number;
+  historyLimit: number;
   bidHistory: Array<{
+    seq: number;
     userId: string;
     handle: string;
     amountCents: number;
@@ -23,7 +26,7 @@ type RoomState = {
     reason?: string;
     createdAt: string;
   }>;
-  participantsList: Array<{ userId: string; handle: string }>;
+  participantsList: Array<{ userId: string; handle: string; displayName?: string; verified?: boolean }>;
 };
 
 export default function AuctionPage({ params }: { params: { id: string } }) {
@@ -34,36 +37,52 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
   const [bidDelta, setBidDelta] = useState<number>(0);
   const connRef = useRef<RealtimeConn | null>(null);
   const [transport, setTransport] = useState<"webrtc" | "ws" | "">("");
-  const [userId, setUserId] = useState<string>("");
+  const [session, setSession] = useState<Session | null>(null);
+
+  const [password, setPassword] = useState<string>("");
+  const [authError, setAuthError] = useState<string>("");
+  // Bids awaiting an ack or nack, by clientMsgId.
+  const pendingBids = useRef<Map<string, number>>(new Map());
+  const [bidNotice, setBidNotice] = useState<string>("");
+  // Set after a gap in room_patch versions until the snapshot arrives.
+  const awaitingSnapshot = useRef(false);
 
   useEffect(() => {
     const saved = localStorage.getItem("rtb_handle") || "";
     setHandle(saved);
-  }, []);
-
-  useEffect(() => {
-    // Safely access localStorage only on client
-    let id = "";
+    // Reuse the stored session until it expires.
     try {
-      id = localStorage.getItem("rtb_user_id") || "";
-      if (!id) {
-        id = crypto.randomUUID();
-        localStorage.setItem("rtb_user_id", id);
+      const stored = JSON.parse(localStorage.getItem("rtb_session") || "null") as Session | null;
+      if (stored && new Date(stored.expiresAt).getTime() > Date.now()) {
+        setSession(stored);
       }
     } catch {}
-    setUserId(id);
   }, []);
 
-  const user = useMemo(() => {
-    const id = userId;
-    const h = handle || (id ? `user-${id.slice(0, 4)}` : "");
-    return { id, handle: h };
-  }, [handle, userId]);
+  async function signIn(create: boolean) {
+    setAuthError("");
+    try {
+      const s = create ? await register(handle, password) : await login(handle, password);
+      localStorage.setItem("rtb_session", JSON.stringify(s));
+      setPassword("");
+      setSession(s);
+    } catch (e: any) {
+      setAuthError(e?.message || "sign in failed");
+    }
+  }
+
+  function signOut() {
+    localStorage.removeItem("rtb_session");
+    connRef.current?.close();
+    setSession(null);
+  }
+
+  const user = session?.user ?? { id: "", handle: "" };
 
   useEffect(() => {
-    if (!user.handle || !user.id) return;
+    if (!session) return;
     let closed = false;
-    connectRealtime(roomId, user, onMessage)
+    connectRealtime(roomId, session.token, onMessage)
       .then((c) => {
         if (closed) {
           c.close();
@@ -78,9 +97,21 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
       connRef.current?.close();
     };
     // eslint-disable-next-line react-hooks/exhaustive-deps
-  }, [user.handle, user.id, roomId]);
+  }, [session, roomId]);
 
   function onMessage(m: RTBMessage) {
+    if (m.type === "ack" || m.type === "nack") {
+      const id = m.payload.clientMsgId;
+      if (!id || !pendingBids.current.has(id)) return;
+      const amount = pendingBids.current.get(id)!;
+      pendingBids.current.delete(id);
+      setBidNotice(
+        m.type === "ack"
+          ? `Bid of $${centsToDisplay(amount)} accepted`
+          : `Bid of $${centsToDisplay(amount)} rejected: ${m.payload.reason.replace(/_/g, " ")}`
+      );
+      return;
+    }
     if (m.type === "room_state") {
       const rs = m.payload as RoomState;
       const fixed: RoomState = {
@@ -88,8 +119,33 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
         bidHistory: (rs as any).bidHistory ?? [],
         participantsList: (rs as any).participantsList ?? [],
       };
+      awaitingSnapshot.current = false;
       setState(fixed);
     }
+    if (m.type === "room_patch") {
+      const patch = m.payload;
+      setState((prev) => {
+        if (!prev || awaitingSnapshot.current) return prev;
+        if (patch.version <= prev.version) return prev;
+        if (patch.version !== prev.version + 1) {
+          // Missed a patch; start over from a full snapshot.
+          awaitingSnapshot.current = true;
+          connRef.current?.send({ type: "snapshot", roomId });
+          return prev;
+        }
+        const next: any = { ...prev, version: patch.version };
+        for (const [k, v] of Object.entries(patch.set ?? {})) {
+          if (v === null) delete next[k];
+          else next[k] = v;
+        }
+        const lastSeq = prev.bidHistory.length ? prev.bidHistory[prev.bidHistory.length - 1].seq : 0;
+        const fresh = (patch.bids ?? []).filter((b) => b.seq > lastSeq);
+        // The room only keeps its latest bids; keep the same tail here.
+        next.bidHistory = [...prev.bidHistory, ...fresh].slice(-(next.historyLimit || 50));
+        next.participantsList = next.participantsList ?? [];
+        return next as RoomState;
+      });
+    }
     if (m.type === "bid_accepted") {
       const p = (m as any).payload as {
         amountCents: number;
@@ -100,23 +156,13 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
       setState((prev) => {
         if (!prev) return prev;
         const endsAtISO = typeof p.endsAt === "string" ? p.endsAt : new Date(p.endsAt).toISOString();
-        const newHistory = [
-          ...((prev as any).bidHistory ?? []),
-          {
-            userId: p.leaderUserId,
-            handle: p.leaderHandle,
-            amountCents: p.amountCents,
-            accepted: true,
-            createdAt: new Date().toISOString(),
-          },
-        ];
+        // The bid itself arrives with the next room_patch.
         return {
           ...prev,
           currentPriceCents: p.amountCents,
           leaderUserId: p.leaderUserId,
           leaderHandle: p.leaderHandle,
           endsAt: endsAtISO,
-          bidHistory: newHistory,
         };
       });
     }
@@ -142,11 +188,13 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
   function placeBid() {
     if (!state || !connRef.current) return;
     const next = state.currentPriceCents + (bidDelta > 0 ? bidDelta * 100 : state.minIncrementCents);
+    const clientMsgId = crypto.randomUUID();
+    pendingBids.current.set(clientMsgId, next);
     connRef.current.send({
       type: "place_bid",
       roomId,
-      user,
       amountCents: next,
+      clientMsgId,
     });
   }
 
@@ -160,7 +208,7 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
       <div className="bg-neutral-900 rounded-lg p-4">
         <div className="font-medium mb-1">How it works</div>
         <ul className="text-sm text-neutral-300 list-disc pl-5 space-y-1">
-          <li>Enter your handle, then place bids.</li>
+          <li>Log in or register, then place bids.</li>
           <li>The next valid bid must be at least the current price + minimum increment.</li>
           <li>If a bid arrives near the end, the timer extends (anti-sniping).</li>
         </ul>
@@ -200,13 +248,39 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
 
           <div className="bg-neutral-900 rounded-lg p-4 space-y-3">
             <div className="text-lg font-medium">Place bid</div>
+            {session ? (
+              <div className="text-sm text-neutral-400">
+                Bidding as <span className="text-neutral-200">{session.user.displayName || user.handle}</span>{" "}
+                (@{user.handle}){" "}
+                <button onClick={signOut} className="underline text-neutral-300">
+                  Sign out
+                </button>
+              </div>
+            ) : (
+              <div className="grid sm:grid-cols-4 gap-3">
+                <input
+                  placeholder="Handle"
+                  value={handle}
+                  onChange={(e) => saveHandle(e.target.value)}
+                  className="px-3 py-2 rounded border border-neutral-800"
+                />
+                <input
+                  type="password"
+                  placeholder="Password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  className="px-3 py-2 rounded border border-neutral-800"
+                />
+                <button onClick={() => signIn(false)} className="px-4 py-2 bg-neutral-700 hover:bg-neutral-600 rounded">
+                  Log in
+                </button>
+                <button onClick={() => signIn(true)} className="px-4 py-2 bg-neutral-700 hover:bg-neutral-600 rounded">
+                  Register
+                </button>
+              </div>
+            )}
+            {authError && <div className="text-xs text-red-400">{authError}</div>}
             <div className="grid sm:grid-cols-3 gap-3">
-              <input
-                placeholder="Your handle"
-                value={handle}
-                onChange={(e) => saveHandle(e.target.value)}
-                className="px-3 py-2 rounded border border-neutral-800"
-              />
               <input
                 type="number"
                 min={0}
@@ -218,13 +292,14 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
               />
               <button
                 onClick={placeBid}
-                disabled={!user.handle}
+                disabled={!session}
                 className="px-4 py-2 bg-emerald-600 hover:bg-emerald-700 rounded disabled:opacity-50"
               >
                 Bid +${bidDelta > 0 ? bidDelta.toFixed(2) : centsToDisplay(state?.minIncrementCents || 0)}
               </button>
             </div>
-            {!user.handle && <div className="text-xs text-red-400">Enter your handle to enable bidding.</div>}
+            {!session && <div className="text-xs text-red-400">Log in or register to enable bidding.</div>}
+            {bidNotice && <div className="text-xs text-neutral-300">{bidNotice}</div>}
           </div>
         </div>
 
@@ -235,7 +310,8 @@ export default function AuctionPage({ params }: { params: { id: string } }) {
               {state?.participantsList?.length ? (
                 state.participantsList.map((p) => (
                   <div key={p.userId} className="text-sm text-neutral-300">
-                    {p.handle || p.userId.slice(0, 6)}
+                    {p.displayName || p.handle || p.userId.slice(0, 6)}
+                    {p.verified && <span className="ml-1 text-emerald-400" title="Verified">✓</span>}
                   </div>
                 ))
               ) : (
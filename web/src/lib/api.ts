@@ -34,6 +34,38 @@ export async function createAuction(input: {
   return res.json();
 }
 
+export type Profile = {
+  id: string;
+  handle: string;
+  displayName: string;
+  verified: boolean;
+};
+
+export type Session = {
+  token: string;
+  user: Profile;
+  expiresAt: string;
+};
+
+async function sessionRequest(path: string, body: object): Promise<Session> {
+  const res = await fetch(`${API_URL}${path}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || "request failed");
+  return data;
+}
+
+export function register(handle: string, password: string, displayName?: string): Promise<Session> {
+  return sessionRequest("/api/users", { handle, password, displayName });
+}
+
+export function login(handle: string, password: string): Promise<Session> {
+  return sessionRequest("/api/users/login", { handle, password });
+}
+
 export function centsToDisplay(cents: number): string {
   return (cents / 100).toFixed(2);
 }
@@ -1,14 +1,78 @@
 export type RTBMessage =
-  | { type: "room_state"; roomId: string; payload: any }
-  | { type: "bid_accepted"; roomId: string; payload: any }
-  | { type: "bid_rejected"; roomId: string; payload: any }
-  | { type: "presence"; roomId: string; payload: any }
+  | { type: "room_state"; roomId: string; seq?: number; payload: any }
+  | {
+      type: "room_patch";
+      roomId: string;
+      seq?: number;
+      payload: { version: number; set?: Record<string, any>; bids?: any[] };
+    }
+  | { type: "bid_accepted"; roomId: string; seq?: number; payload: any }
+  | { type: "ack"; roomId: string; payload: { clientMsgId?: string; requestType: string; amountCents?: number } }
+  | { type: "nack"; roomId: string; payload: { clientMsgId?: string; requestType: string; reason: string } }
+  | { type: "presence"; roomId: string; seq?: number; payload: any }
+  | { type: "max_bid_cleared"; roomId: string; payload: { maxCents: number; reason: string } }
   | { type: "error"; message: string; code?: string };
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080";
 
 export type User = { id: string; handle: string };
 
+// The server binds the connection to the user named by the session token
+// (see login in api.ts); messages no longer carry a user. The room hint lets
+// a clustered server hand the connection to the node that runs the room.
+function withToken(url: string, token: string, roomId: string): string {
+  return `${url}?token=${encodeURIComponent(token)}&room=${encodeURIComponent(roomId)}`;
+}
+
+// Last room broadcast seen per room, kept across reconnects so a new
+// connection resumes where the old one stopped instead of rejoining. Seqs
+// only compare within the epoch that numbered them.
+const lastSeq = new Map<string, number>();
+const epochs = new Map<string, string>();
+
+function joinMsg(roomId: string) {
+  const seq = lastSeq.get(roomId);
+  return seq === undefined
+    ? { type: "join_room", roomId }
+    : { type: "resume", roomId, epoch: epochs.get(roomId), lastSeq: seq };
+}
+
+// sequenced drops broadcasts already seen and asks for a resume when one
+// was skipped. Missed room_patch messages are caught by their version
+// instead, and recovered with a snapshot. With split set, the server sends
+// the only droppable messages on a separate tick channel, so gaps on this
+// one are expected and only duplicates are dropped.
+function sequenced(
+  roomId: string,
+  send: (m: any) => void,
+  onMessage: (m: RTBMessage) => void,
+  split = false
+) {
+  return (msg: any) => {
+    if (typeof msg.seq === "number" && msg.roomId === roomId) {
+      if (msg.epoch !== epochs.get(roomId)) {
+        // The room was reloaded, after a restart or a move to another node,
+        // and numbers its broadcasts afresh; only a snapshot re-syncs.
+        epochs.set(roomId, msg.epoch);
+        lastSeq.delete(roomId);
+        if (msg.type !== "room_state") {
+          send({ type: "snapshot", roomId });
+        }
+      }
+      const prev = lastSeq.get(roomId);
+      if (prev !== undefined && msg.seq <= prev && msg.type !== "room_state") {
+        return;
+      }
+      lastSeq.set(roomId, msg.seq);
+      if (!split && prev !== undefined && msg.seq > prev + 1 && msg.type !== "room_state" && msg.type !== "room_patch") {
+        send({ type: "resume", roomId, epoch: msg.epoch, lastSeq: prev });
+        return;
+      }
+    }
+    onMessage(msg);
+  };
+}
+
 export type RealtimeConn = {
   send: (msg: any) => void;
   close: () => void;
@@ -17,34 +81,34 @@ export type RealtimeConn = {
 
 export async function connectRealtime(
   roomId: string,
-  user: User,
+  token: string,
   onMessage: (m: RTBMessage) => void
 ): Promise<RealtimeConn> {
   const force = process.env.NEXT_PUBLIC_TRANSPORT;
   if (force === "ws") {
-    return await connectWS(roomId, user, onMessage);
+    return await connectWS(roomId, token, onMessage);
   }
   try {
-    return await connectWebRTC(roomId, user, onMessage);
+    return await connectWebRTC(roomId, token, onMessage);
   } catch (e) {
     console.warn("WebRTC failed, falling back to WebSocket", e);
-    return await connectWS(roomId, user, onMessage);
+    return await connectWS(roomId, token, onMessage);
   }
 }
 
 async function connectWS(
   roomId: string,
-  user: User,
+  token: string,
   onMessage: (m: RTBMessage) => void
 ): Promise<RealtimeConn> {
-  const ws = new WebSocket(`${API_URL.replace(/^http/, "ws")}/ws`);
+  const ws = new WebSocket(withToken(`${API_URL.replace(/^http/, "ws")}/ws`, token, roomId));
+  const handle = sequenced(roomId, (m) => ws.send(JSON.stringify(m)), onMessage);
   ws.onopen = () => {
-    ws.send(JSON.stringify({ type: "join_room", roomId, user }));
+    ws.send(JSON.stringify(joinMsg(roomId)));
   };
   ws.onmessage = (ev) => {
     try {
-      const msg = JSON.parse(ev.data);
-      onMessage(msg);
+      handle(JSON.parse(ev.data));
     } catch {}
   };
   return {
@@ -54,63 +118,94 @@ async function connectWS(
   };
 }
 
+// fetchIceServers returns the STUN/TURN servers configured on the server.
+async function fetchIceServers(token: string): Promise<RTCIceServer[]> {
+  const res = await fetch(`${API_URL}/api/ice-servers`, { headers: { Authorization: `Bearer ${token}` } });
+  if (!res.ok) throw new Error(`ice servers: ${res.status}`);
+  return (await res.json()).iceServers as RTCIceServer[];
+}
+
 async function connectWebRTC(
   roomId: string,
-  user: User,
+  token: string,
   onMessage: (m: RTBMessage) => void
 ): Promise<RealtimeConn> {
-  const pc = new RTCPeerConnection({
-    iceServers: [{ urls: ["stun:stun.l.google.com:19302"] }],
-  });
+  const pc = new RTCPeerConnection({ iceServers: await fetchIceServers(token) });
   const dc = pc.createDataChannel("rtb-v1");
+  // room_patch and presence ride an unordered, lossy channel so a lost
+  // packet never delays bids; patch versions catch what goes missing.
+  const ticks = pc.createDataChannel("rtb-v1-ticks", { ordered: false, maxRetransmits: 0 });
+  const handle = sequenced(roomId, (m) => dc.send(JSON.stringify(m)), onMessage, true);
   dc.onmessage = (ev) => {
+    try {
+      handle(JSON.parse(ev.data));
+    } catch {}
+  };
+  ticks.onmessage = (ev) => {
     try {
       onMessage(JSON.parse(ev.data));
     } catch {}
   };
+
+  // Trickle ICE: the offer goes out right away and candidates follow over
+  // the signaling socket in both directions until the channel opens.
+  const ws = new WebSocket(withToken(`${API_URL.replace(/^http/, "ws")}/signal`, token, roomId));
+  const sendSignal = (m: any) => ws.readyState === ws.OPEN && ws.send(JSON.stringify(m));
+  const pending: RTCIceCandidateInit[] = [];
+  pc.onicecandidate = (ev) => {
+    const msg = { type: "candidate", candidate: ev.candidate ? ev.candidate.toJSON() : undefined };
+    if (ws.readyState === ws.OPEN) sendSignal(msg);
+    else if (ev.candidate) pending.push(ev.candidate.toJSON());
+  };
   await pc.setLocalDescription(await pc.createOffer());
-  await waitIceComplete(pc);
-  const offerSDP = pc.localDescription?.sdp!;
 
-  const ws = new WebSocket(`${API_URL.replace(/^http/, "ws")}/signal`);
-  const answerSDP: string = await new Promise((resolve, reject) => {
+  await new Promise<void>((resolve, reject) => {
+    const timeout = setTimeout(() => reject(new Error("signal timeout")), 8000);
     ws.onopen = () => {
-      ws.send(JSON.stringify({ type: "offer", sdp: offerSDP }));
+      sendSignal({ type: "offer", sdp: pc.localDescription?.sdp, trickle: true });
+      for (const c of pending.splice(0)) sendSignal({ type: "candidate", candidate: c });
     };
-    ws.onmessage = (ev) => {
+    ws.onmessage = async (ev) => {
       try {
         const msg = JSON.parse(ev.data);
         if (msg.type === "answer") {
-          resolve(msg.sdp as string);
-          ws.close();
+          await pc.setRemoteDescription({ type: "answer", sdp: msg.sdp });
+          clearTimeout(timeout);
+          resolve();
+        } else if (msg.type === "candidate" && msg.candidate) {
+          await pc.addIceCandidate(msg.candidate);
+        } else if (msg.type === "error") {
+          reject(new Error(msg.message));
         }
       } catch (e) {
         reject(e);
       }
     };
     ws.onerror = reject as any;
-    setTimeout(() => reject(new Error("signal timeout")), 8000);
   });
 
-  await pc.setRemoteDescription({ type: "answer", sdp: answerSDP });
-
-  await new Promise<void>((resolve, reject) => {
-    const dcTimeout = process.env.NODE_ENV === "production" ? 2000 : 8000;
-    const timeout = setTimeout(() => reject(new Error("dc open timeout")), dcTimeout);
-    dc.onopen = () => {
-      clearTimeout(timeout);
-      resolve();
-    };
-  });
+  try {
+    await new Promise<void>((resolve, reject) => {
+      const dcTimeout = process.env.NODE_ENV === "production" ? 2000 : 8000;
+      const timeout = setTimeout(() => reject(new Error("dc open timeout")), dcTimeout);
+      dc.onopen = () => {
+        clearTimeout(timeout);
+        resolve();
+      };
+    });
+  } finally {
+    ws.close();
+  }
 
   // Join after DC open
-  dc.send(JSON.stringify({ type: "join_room", roomId, user }));
+  dc.send(JSON.stringify(joinMsg(roomId)));
 
   return {
     send: (m) => dc.readyState === "open" && dc.send(JSON.stringify(m)),
     close: () => {
       try {
         dc.close();
+        ticks.close();
       } catch {}
       try {
         pc.close();
@@ -119,21 +214,3 @@ async function connectWebRTC(
     transport: "webrtc",
   };
 }
-
-function waitIceComplete(pc: RTCPeerConnection): Promise<void> {
-  return new Promise((resolve) => {
-    if (pc.iceGatheringState === "complete") {
-      resolve();
-      return;
-    }
-    function check() {
-      if (pc.iceGatheringState === "complete") {
-        pc.removeEventListener("icegatheringstatechange", check);
-        resolve();
-      }
-    }
-    pc.addEventListener("icegatheringstatechange", check);
-  });
-}
-
-